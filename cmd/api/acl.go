@@ -0,0 +1,172 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) listFoodScaleACLHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entries, err := app.models.ACL.GetAllForFoodScale(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"acl": entries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) grantFoodScaleACLHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		UserID  *int64 `json:"user_id"`
+		GroupID *int64 `json:"group_id"`
+		Role    string `json:"role"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	entry := &data.ACLEntry{
+		FoodScaleID: id,
+		UserID:      input.UserID,
+		GroupID:     input.GroupID,
+		Role:        input.Role,
+	}
+
+	v := validator.New()
+	if data.ValidateACLEntry(v, entry); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ACL.Grant(entry)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownACLSubject):
+			v.AddError("user_id", "must reference an existing user or group")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "acl.grant", ResourceType: data.AuditResourceACL, ResourceID: &entry.ID}, nil, entry)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"acl_entry": entry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) revokeFoodScaleACLHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	entryID, err := app.readInt64Param(r, "entryID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.ACL.Revoke(id, entryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "acl.revoke", ResourceType: data.AuditResourceACL, ResourceID: &entryID}, map[string]int64{"id": entryID, "foodscale_id": id}, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "acl entry successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) transferFoodScaleOwnerHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	foodscales, err := app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *foodscales
+
+	var input struct {
+		UserID  *int64 `json:"user_id"`
+		GroupID *int64 `json:"group_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.UserID != nil || input.GroupID != nil, "user_id", "either user_id or group_id must be provided")
+	v.Check(input.UserID == nil || input.GroupID == nil, "user_id", "must not be provided together with group_id")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.FoodScales.SetOwner(foodscales, input.UserID, input.GroupID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrUnknownACLSubject):
+			v.AddError("user_id", "must reference an existing user or group")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "foodscale.transfer_owner", ResourceType: data.AuditResourceFoodScale, ResourceID: &id}, before, foodscales)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
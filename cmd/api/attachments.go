@@ -0,0 +1,521 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	minImageDimension = 16
+	maxImageDimension = 8000
+
+	// multipartOverhead is allowed on top of the upload size limit for the
+	// part headers and boundaries of the request body.
+	multipartOverhead = 64 << 10
+)
+
+// attachmentKinds maps the content types accepted for upload, as sniffed from
+// the file itself, to the kind of attachment they make.
+var attachmentKinds = map[string]string{
+	"image/jpeg":      data.AttachmentImage,
+	"image/png":       data.AttachmentImage,
+	"image/gif":       data.AttachmentImage,
+	"application/pdf": data.AttachmentDocument,
+	"text/plain":      data.AttachmentDocument,
+}
+
+// attachmentView is an attachment as returned by the API, with signed links
+// to download it and, for images, its thumbnail.
+type attachmentView struct {
+	*data.Attachment
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	URLExpiry    time.Time `json:"url_expiry"`
+}
+
+func (app *application) attachmentView(a *data.Attachment) attachmentView {
+	expiry := time.Now().Add(app.config.uploads.urlTTL).Truncate(time.Second)
+
+	view := attachmentView{Attachment: a, URLExpiry: expiry}
+	view.URL = app.signedAttachmentURL(a.ID, "download", expiry)
+	if a.ThumbnailKey != nil {
+		view.ThumbnailURL = app.signedAttachmentURL(a.ID, "thumbnail", expiry)
+	}
+	return view
+}
+
+// attachmentSignature authenticates a download link. It covers the
+// attachment, the variant and the expiry, so none of them can be changed
+// without invalidating the link.
+func (app *application) attachmentSignature(id int64, variant string, expiry int64) string {
+	mac := hmac.New(sha256.New, []byte(app.config.uploads.signingKey))
+	fmt.Fprintf(mac, "%d:%s:%d", id, variant, expiry)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (app *application) signedAttachmentURL(id int64, variant string, expiry time.Time) string {
+	exp := expiry.Unix()
+	return fmt.Sprintf("/v1/attachments/%d/%s?expires=%d&signature=%s", id, variant, exp, app.attachmentSignature(id, variant, exp))
+}
+
+// sanitizeFilename keeps the base name of an uploaded file without control
+// characters, so it can be echoed back in a Content-Disposition header.
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+func randomBlobName() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (app *application) uploadTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the uploaded file must not be larger than %d bytes", app.config.uploads.maxBytes)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
+// uploadAttachmentHandler accepts a multipart/form-data body with the file in
+// the "file" field. The declared content type is ignored: the type is sniffed
+// from the content and must be one of attachmentKinds. Images are checked for
+// their dimensions and get a PNG thumbnail.
+func (app *application) uploadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	maxBytes := app.config.uploads.maxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	v := validator.New()
+
+	var filename string
+	var size int64
+	hash := sha256.New()
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.uploadTooLargeResponse(w, r)
+				return
+			}
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if part.FormName() != "file" || filename != "" {
+			part.Close()
+			continue
+		}
+
+		filename = sanitizeFilename(part.FileName())
+
+		size, err = io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(part, maxBytes+1))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.uploadTooLargeResponse(w, r)
+				return
+			}
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		part.Close()
+
+		if size > maxBytes {
+			app.uploadTooLargeResponse(w, r)
+			return
+		}
+	}
+
+	v.Check(filename != "", "file", "must be provided")
+	v.Check(filename == "" || size > 0, "file", "must not be empty")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+
+	kind, ok := attachmentKinds[contentType]
+	if !ok {
+		v.AddError("file", fmt.Sprintf("must be a JPEG, PNG or GIF image, a PDF or a plain text file, not %s", contentType))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	attachment := &data.Attachment{
+		FoodScaleID: id,
+		UploadedBy:  &app.contextGetUser(r).ID,
+		Kind:        kind,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		SHA256:      hash.Sum(nil),
+	}
+
+	name, err := randomBlobName()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	attachment.BlobKey = fmt.Sprintf("scales/%d/%s", id, name)
+
+	var thumb []byte
+
+	if kind == data.AttachmentImage {
+		config, _, err := image.DecodeConfig(io.NewSectionReader(tmp, 0, size))
+		if err != nil {
+			v.AddError("file", "is not a valid image")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		v.Check(config.Width >= minImageDimension && config.Height >= minImageDimension, "file", fmt.Sprintf("must be at least %d pixels wide and high", minImageDimension))
+		v.Check(config.Width <= maxImageDimension && config.Height <= maxImageDimension, "file", fmt.Sprintf("must not be more than %d pixels wide or high", maxImageDimension))
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// Decoding only starts once the dimensions are known to be sane, so a
+		// small file cannot claim a huge image and exhaust memory.
+		img, _, err := image.Decode(io.NewSectionReader(tmp, 0, size))
+		if err != nil {
+			v.AddError("file", "is not a valid image")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		var buf bytes.Buffer
+		err = png.Encode(&buf, thumbnail(img, thumbnailSize))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		thumb = buf.Bytes()
+
+		thumbnailKey := attachment.BlobKey + "-thumbnail.png"
+		attachment.ThumbnailKey = &thumbnailKey
+		attachment.Width = &config.Width
+		attachment.Height = &config.Height
+	}
+
+	err = app.blobs.Put(r.Context(), attachment.BlobKey, io.NewSectionReader(tmp, 0, size))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if attachment.ThumbnailKey != nil {
+		err = app.blobs.Put(r.Context(), *attachment.ThumbnailKey, bytes.NewReader(thumb))
+		if err != nil {
+			app.deleteAttachmentBlobs(r, attachment)
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Attachments.Insert(attachment)
+	if err != nil {
+		app.deleteAttachmentBlobs(r, attachment)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "attachment.create", ResourceType: data.AuditResourceAttachment, ResourceID: &attachment.ID}, nil, attachment)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/scales/%d/attachments/%d", id, attachment.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": app.attachmentView(attachment)}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAttachmentBlobs removes the attachment's blobs, logging rather than
+// returning failures: a leftover blob wastes space but breaks nothing.
+func (app *application) deleteAttachmentBlobs(r *http.Request, a *data.Attachment) {
+	keys := []string{a.BlobKey}
+	if a.ThumbnailKey != nil {
+		keys = append(keys, *a.ThumbnailKey)
+	}
+
+	for _, key := range keys {
+		err := app.blobs.Delete(r.Context(), key)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	attachments, err := app.models.Attachments.GetAllForFoodScale(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	views := make([]attachmentView, len(attachments))
+	for i, a := range attachments {
+		views[i] = app.attachmentView(a)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": views}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAttachment loads the attachment named by the :id and :attachmentID
+// parameters, as long as its scale is not in the trash. It returns nil when a
+// response has been written.
+func (app *application) readAttachment(w http.ResponseWriter, r *http.Request) *data.Attachment {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	attachmentID, err := app.readInt64Param(r, "attachmentID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	_, err = app.models.FoodScales.Get(id)
+	if err == nil {
+		var a *data.Attachment
+		a, err = app.models.Attachments.Get(id, attachmentID)
+		if err == nil {
+			return a
+		}
+	}
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+	return nil
+}
+
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.readAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"attachment": app.attachmentView(attachment)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment := app.readAttachment(w, r)
+	if attachment == nil {
+		return
+	}
+
+	err := app.models.Attachments.Delete(attachment.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.deleteAttachmentBlobs(r, attachment)
+
+	app.audit(r, &data.AuditEvent{Action: "attachment.delete", ResourceType: data.AuditResourceAttachment, ResourceID: &attachment.ID}, attachment, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) downloadAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveAttachment(w, r, "download")
+}
+
+func (app *application) downloadAttachmentThumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveAttachment(w, r, "thumbnail")
+}
+
+// serveAttachment streams an attachment or its thumbnail to anyone holding a
+// valid signed link, so links can be used directly in img tags and browsers.
+func (app *application) serveAttachment(w http.ResponseWriter, r *http.Request, variant string) {
+	id, err := app.readInt64Param(r, "attachmentID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	expiry, err := strconv.ParseInt(qs.Get("expires"), 10, 64)
+	signature := qs.Get("signature")
+
+	if err != nil || time.Now().Unix() > expiry ||
+		!hmac.Equal([]byte(signature), []byte(app.attachmentSignature(id, variant, expiry))) {
+		app.errorResponse(w, r, http.StatusForbidden, "the download link is invalid or has expired")
+		return
+	}
+
+	attachment, err := app.models.Attachments.Get(0, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	key, contentType, etag := attachment.BlobKey, attachment.ContentType, hex.EncodeToString(attachment.SHA256)
+	if variant == "thumbnail" {
+		if attachment.ThumbnailKey == nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		key, contentType, etag = *attachment.ThumbnailKey, "image/png", etag+"-thumbnail"
+	}
+	etag = `"` + etag + `"`
+
+	if app.checkIfNoneMatch(w, r, etag) {
+		return
+	}
+
+	blob, err := app.blobs.Get(r.Context(), key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer blob.Close()
+
+	if contentType == "text/plain" {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	disposition := "inline"
+	if attachment.Kind == data.AttachmentDocument && variant == "download" {
+		disposition = "attachment"
+	}
+
+	if formatted := mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}); formatted != "" {
+		disposition = formatted
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", expiry-time.Now().Unix()))
+	w.Header().Set("ETag", etag)
+	if variant == "download" {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+
+	_, err = io.Copy(w, blob)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
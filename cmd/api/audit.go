@@ -0,0 +1,87 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// audit fills in the actor, client IP and request ID of the event and appends
+// it to the audit log. before and after are snapshots of the resource and may
+// be nil on creation and deletion. Failures are only logged because the
+// mutation being audited has already been carried out.
+func (app *application) audit(r *http.Request, event *data.AuditEvent, before, after interface{}) {
+	if event.ActorID == nil {
+		user, ok := r.Context().Value(userContextKey).(*data.User)
+		if ok && !user.IsAnonymous() {
+			event.ActorID = &user.ID
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	event.IP = ip
+	event.RequestID = app.contextGetRequestID(r)
+
+	if before != nil {
+		event.Before, err = json.Marshal(before)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+	}
+	if after != nil {
+		event.After, err = json.Marshal(after)
+		if err != nil {
+			app.logError(r, err)
+			return
+		}
+	}
+
+	err = app.models.Audit.Insert(event)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) listAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.AuditQuery
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.ActorID = int64(app.readInt(qs, "actor_id", 0, v))
+	input.Action = app.readString(qs, "action", "")
+	input.ResourceType = app.readString(qs, "resource_type", "")
+	input.ResourceID = int64(app.readInt(qs, "resource_id", 0, v))
+	input.From = app.readTime(qs, "from", v)
+	input.To = app.readTime(qs, "to", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+	input.Filters.SortSafelist = []string{"id", "created_at", "-id", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(input.AuditQuery, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_events": events, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
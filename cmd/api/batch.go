@@ -0,0 +1,454 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	batchModeTransaction = "transaction"
+	batchModePartial     = "partial"
+
+	maxBatchOperations = 500
+)
+
+// errBatchAborted rolls back a transactional batch once one of its operations
+// has failed.
+var errBatchAborted = errors.New("batch aborted")
+
+type batchOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version int32           `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// batchResponseWriter buffers the response of a single batch operation so it
+// can be embedded in the batch result.
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBatchResponseWriter() *batchResponseWriter {
+	return &batchResponseWriter{header: make(http.Header)}
+}
+
+func (bw *batchResponseWriter) Header() http.Header {
+	return bw.header
+}
+
+func (bw *batchResponseWriter) WriteHeader(status int) {
+	if bw.status == 0 {
+		bw.status = status
+	}
+}
+
+func (bw *batchResponseWriter) Write(b []byte) (int, error) {
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	return bw.body.Write(b)
+}
+
+// batchRun carries what the operations of one batch share: the request, the
+// model they write through and the audit events held back until the writes
+// are known to stick.
+type batchRun struct {
+	app         *application
+	r           *http.Request
+	user        *data.User
+	permissions data.Permissions
+	scales      data.FoodScaleModel
+	audits      []func()
+}
+
+// batchFoodScalesHandler applies a list of create, update and delete
+// operations. In transaction mode they all succeed or none are kept; in
+// partial mode every operation stands on its own. Each result carries the
+// status and body the individual endpoint would have returned.
+func (app *application) batchFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mode       string           `json:"mode"`
+		Operations []batchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = batchModeTransaction
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.Mode, batchModeTransaction, batchModePartial), "mode", "must be transaction or partial")
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least one operation")
+	v.Check(len(input.Operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+	for i, op := range input.Operations {
+		key := fmt.Sprintf("operations[%d]", i)
+		v.Check(validator.In(op.Op, "create", "update", "delete"), key+".op", "must be create, update or delete")
+		if op.Op != "create" {
+			v.Check(op.ID > 0, key+".id", "must be provided")
+		}
+		if op.Op != "delete" {
+			v.Check(len(op.Data) > 0, key+".data", "must be provided")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	results := make([]envelope, len(input.Operations))
+	succeeded := 0
+
+	run := &batchRun{app: app, r: r, user: user, permissions: permissions}
+
+	switch input.Mode {
+	case batchModePartial:
+		run.scales = app.models.FoodScales
+
+		for i, op := range input.Operations {
+			results[i] = run.apply(i, op)
+			if results[i]["status"].(int) < 300 {
+				succeeded++
+			}
+		}
+
+	case batchModeTransaction:
+		status := http.StatusOK
+		failed := -1
+
+		err = app.models.FoodScales.Transaction(func(scales data.FoodScaleModel) error {
+			run.scales = scales
+
+			for i, op := range input.Operations {
+				results[i] = run.apply(i, op)
+				if results[i]["status"].(int) >= 300 {
+					status = results[i]["status"].(int)
+					failed = i
+					return errBatchAborted
+				}
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBatchAborted) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if failed >= 0 {
+			message := fmt.Sprintf("not applied because operation %d failed and the batch was rolled back", failed)
+			for i, op := range input.Operations {
+				if i != failed {
+					results[i] = envelope{"index": i, "op": op.Op, "status": http.StatusFailedDependency, "error": message}
+				}
+			}
+
+			err = app.writeJSON(w, status, envelope{"mode": input.Mode, "succeeded": 0, "failed": len(results), "results": results}, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		succeeded = len(results)
+	}
+
+	for _, audit := range run.audits {
+		audit()
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"mode": input.Mode, "succeeded": succeeded, "failed": len(results) - succeeded, "results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// apply runs one operation and turns its response into a batch result.
+func (b *batchRun) apply(i int, op batchOperation) envelope {
+	bw := newBatchResponseWriter()
+
+	// Each operation gets its own copy of the request so that readJSON can
+	// decode the operation's data the same way the individual endpoints
+	// decode their body.
+	r := b.r.Clone(b.r.Context())
+	r.Body = io.NopCloser(bytes.NewReader(op.Data))
+
+	switch op.Op {
+	case "create":
+		b.create(bw, r)
+	case "update":
+		b.update(bw, r, op)
+	case "delete":
+		b.delete(bw, r, op)
+	}
+
+	result := envelope{}
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(bw.body.Bytes(), &body); err == nil {
+		for key, value := range body {
+			result[key] = value
+		}
+	}
+
+	result["index"] = i
+	result["op"] = op.Op
+	result["status"] = bw.status
+	if etag := bw.header.Get("ETag"); etag != "" {
+		result["etag"] = etag
+	}
+	return result
+}
+
+// allowed reports whether the user holds at least role on the scale and
+// writes the matching error response when they do not. Scales the user holds
+// no role on are reported as not found, as checkFoodScaleRole does. The role is looked up
+// through the batch's model, so in transaction mode scales created earlier in
+// the same batch are found.
+func (b *batchRun) allowed(w http.ResponseWriter, r *http.Request, id int64, role string) bool {
+	if b.permissions.Include("scales:admin") {
+		return true
+	}
+
+	have, err := b.scales.RoleForUser(id, b.user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			b.app.notFoundResponse(w, r)
+		default:
+			b.app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	switch {
+	case have == "":
+		b.app.notFoundResponse(w, r)
+		return false
+	case !data.RoleIncludes(have, role):
+		b.app.notPermittedResponse(w, r)
+		return false
+	}
+	return true
+}
+
+func (b *batchRun) create(w http.ResponseWriter, r *http.Request) {
+	var input foodScaleDocument
+
+	err := b.app.readJSON(w, r, &input)
+	if err != nil {
+		b.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	foodscale := &data.FoodScales{
+		Version:     1,
+		CreatedBy:   &b.user.ID,
+		OwnerUserID: &b.user.ID,
+	}
+	input.applyTo(foodscale)
+
+	v := validator.New()
+	if data.ValidateFoodScales(v, foodscale); !v.Valid() {
+		b.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = b.scales.Insert(foodscale)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a scale with this sku already exists")
+			b.app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateGTIN):
+			v.AddError("gtin", "a scale with this gtin already exists")
+			b.app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownManufacturer):
+			v.AddError("manufacturer_id", "must refer to an existing manufacturer")
+			b.app.failedValidationResponse(w, r, v.Errors)
+		default:
+			b.app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	b.audits = append(b.audits, func() {
+		b.app.audit(r, &data.AuditEvent{Action: "foodscale.create", ResourceType: data.AuditResourceFoodScale, ResourceID: &foodscale.ID}, nil, foodscale)
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/scales/%d", foodscale.ID))
+	headers.Set("ETag", foodScaleETag(foodscale))
+
+	err = b.app.writeJSON(w, http.StatusCreated, envelope{"foodscale": foodscale}, headers)
+	if err != nil {
+		b.app.serverErrorResponse(w, r, err)
+	}
+}
+
+// update applies data as a partial update like PATCH does. When the operation
+// names a version the update only goes through if the scale is still at it.
+func (b *batchRun) update(w http.ResponseWriter, r *http.Request, op batchOperation) {
+	if !b.allowed(w, r, op.ID, data.RoleEditor) {
+		return
+	}
+
+	foodscales, err := b.scales.Get(op.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			b.app.notFoundResponse(w, r)
+		default:
+			b.app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *foodscales
+
+	var input struct {
+		Model          *string       `json:"model" `
+		Price          *float32      `json:"price"`
+		Year           *int32        `json:"year" `
+		Runtime        *data.Runtime `json:"runtime" `
+		Dimensions     []float32     `json:"dimensions" `
+		SKU            *string       `json:"sku"`
+		GTIN           *string       `json:"gtin"`
+		ManufacturerID *int64        `json:"manufacturer_id"`
+	}
+
+	err = b.app.readJSON(w, r, &input)
+	if err != nil {
+		b.app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Model != nil {
+		foodscales.Model = *input.Model
+	}
+	if input.Price != nil {
+		foodscales.Price = *input.Price
+	}
+	if input.Year != nil {
+		foodscales.Year = *input.Year
+	}
+	if input.Runtime != nil {
+		foodscales.Runtime = *input.Runtime
+	}
+	if input.Dimensions != nil {
+		foodscales.Dimensions = input.Dimensions
+	}
+	if input.SKU != nil {
+		foodscales.SKU = input.SKU
+	}
+	if input.GTIN != nil {
+		foodscales.GTIN = input.GTIN
+	}
+	if input.ManufacturerID != nil {
+		foodscales.ManufacturerID = input.ManufacturerID
+	}
+	if op.Version != 0 {
+		foodscales.Version = op.Version
+	}
+
+	v := validator.New()
+	if data.ValidateFoodScales(v, foodscales); !v.Valid() {
+		b.app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = b.scales.Update(foodscales)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a scale with this sku already exists")
+			b.app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateGTIN):
+			v.AddError("gtin", "a scale with this gtin already exists")
+			b.app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownManufacturer):
+			v.AddError("manufacturer_id", "must refer to an existing manufacturer")
+			b.app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			b.app.editConflictResponse(w, r)
+		default:
+			b.app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	b.audits = append(b.audits, func() {
+		b.app.audit(r, &data.AuditEvent{Action: "foodscale.update", ResourceType: data.AuditResourceFoodScale, ResourceID: &foodscales.ID}, before, foodscales)
+	})
+
+	headers := make(http.Header)
+	headers.Set("ETag", foodScaleETag(foodscales))
+
+	err = b.app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, headers)
+	if err != nil {
+		b.app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (b *batchRun) delete(w http.ResponseWriter, r *http.Request, op batchOperation) {
+	if !b.allowed(w, r, op.ID, data.RoleOwner) {
+		return
+	}
+
+	foodscales, err := b.scales.Get(op.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			b.app.notFoundResponse(w, r)
+		default:
+			b.app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if op.Version != 0 && op.Version != foodscales.Version {
+		b.app.editConflictResponse(w, r)
+		return
+	}
+
+	err = b.scales.Delete(op.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			b.app.notFoundResponse(w, r)
+		default:
+			b.app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	b.audits = append(b.audits, func() {
+		b.app.audit(r, &data.AuditEvent{Action: "foodscale.delete", ResourceType: data.AuditResourceFoodScale, ResourceID: &foodscales.ID}, foodscales, nil)
+	})
+
+	err = b.app.writeJSON(w, http.StatusOK, envelope{"message": "foodscales successfully moved to trash"}, nil)
+	if err != nil {
+		b.app.serverErrorResponse(w, r, err)
+	}
+}
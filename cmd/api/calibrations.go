@@ -0,0 +1,251 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+const calibrationReminderTemplate = "calibration_reminder.tmpl"
+
+func (app *application) createCalibrationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		CalibratedOn data.Date `json:"calibrated_on"`
+		NextDueOn    data.Date `json:"next_due_on"`
+		Technician   string    `json:"technician"`
+		Tests        []struct {
+			NominalGrams   float64 `json:"nominal_grams"`
+			MeasuredGrams  float64 `json:"measured_grams"`
+			ToleranceGrams float64 `json:"tolerance_grams"`
+		} `json:"tests"`
+		Notes string `json:"notes"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	calibration := &data.Calibration{
+		FoodScaleID:  id,
+		CalibratedOn: input.CalibratedOn,
+		NextDueOn:    input.NextDueOn,
+		Technician:   input.Technician,
+		Notes:        input.Notes,
+		RecordedBy:   &user.ID,
+	}
+	for _, t := range input.Tests {
+		calibration.Tests = append(calibration.Tests, data.CalibrationTest{
+			NominalGrams:   t.NominalGrams,
+			MeasuredGrams:  t.MeasuredGrams,
+			ToleranceGrams: t.ToleranceGrams,
+		})
+	}
+
+	v := validator.New()
+	if data.ValidateCalibration(v, calibration); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Calibrations.Insert(calibration)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "calibration.create", ResourceType: data.AuditResourceCalibration, ResourceID: &calibration.ID}, nil, calibration)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/scales/%d/calibrations/%d", id, calibration.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"calibration": calibration}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCalibrationsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	calibrations, metadata, err := app.models.Calibrations.GetAllForFoodScale(id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"calibrations": calibrations, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCalibration loads the calibration named by the :id and :calibrationID
+// parameters along with its scale, as long as the scale is not in the trash.
+// It returns nils when a response has been written.
+func (app *application) readCalibration(w http.ResponseWriter, r *http.Request) (*data.FoodScales, *data.Calibration) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil
+	}
+
+	calibrationID, err := app.readInt64Param(r, "calibrationID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil
+	}
+
+	foodscale, err := app.models.FoodScales.Get(id)
+	if err == nil {
+		var calibration *data.Calibration
+		calibration, err = app.models.Calibrations.Get(id, calibrationID)
+		if err == nil {
+			return foodscale, calibration
+		}
+	}
+
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+	return nil, nil
+}
+
+func (app *application) showCalibrationHandler(w http.ResponseWriter, r *http.Request) {
+	_, calibration := app.readCalibration(w, r)
+	if calibration == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"calibration": calibration}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// downloadCalibrationCertificateHandler renders the calibration's certificate
+// as a PDF.
+func (app *application) downloadCalibrationCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	foodscale, calibration := app.readCalibration(w, r)
+	if calibration == nil {
+		return
+	}
+
+	certificate, err := renderCalibrationCertificate(foodscale, calibration)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	filename := calibration.CertificateNumber() + ".pdf"
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Length", strconv.Itoa(len(certificate)))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	w.Write(certificate)
+}
+
+// listOverdueCalibrationsHandler lists the scales due for calibration, or
+// failing their latest one. With due_within set, scales falling due in that
+// many days are included.
+func (app *application) listOverdueCalibrationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DueWithin int
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.DueWithin = app.readInt(qs, "due_within", 0, v)
+	v.Check(input.DueWithin >= 0 && input.DueWithin <= 366, "due_within", "must be between 0 and 366 days")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	overdue, metadata, err := app.models.Calibrations.GetOverdue(data.Today().AddDays(input.DueWithin), visibleTo, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"overdue": overdue, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// queueCalibrationReminders puts reminder emails for calibrations falling due
+// on the mail queue.
+func (app *application) queueCalibrationReminders() error {
+	queued, err := app.models.Calibrations.QueueReminders(calibrationReminderTemplate, app.config.calibrations.remindDays)
+	if err != nil {
+		return err
+	}
+
+	if queued > 0 {
+		app.logger.PrintInfo("queued calibration reminder emails", map[string]string{"count": fmt.Sprint(queued)})
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/pdf"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	certificateMargin = 56.0
+	certificateRight  = pdf.PageWidth - certificateMargin
+
+	// certificateBottom is the lowest baseline body text is set on, which
+	// keeps it clear of the footer.
+	certificateBottom = certificateMargin + 36
+)
+
+// renderCalibrationCertificate lays the calibration of the scale out as a PDF
+// certificate. Long values and notes are wrapped, and the content continues
+// on further pages when it does not fit on one.
+func renderCalibrationCertificate(fs *data.FoodScales, c *data.Calibration) ([]byte, error) {
+	doc := pdf.New("Calibration certificate " + c.CertificateNumber())
+	page := doc.AddPage()
+	pages := []*pdf.Page{page}
+
+	y := pdf.PageHeight - certificateMargin - 18
+	page.Text(certificateMargin, y, pdf.Bold, 20, "Calibration certificate")
+	number := c.CertificateNumber()
+	page.Text(certificateRight-pdf.Width(pdf.Bold, 12, number), y, pdf.Bold, 12, number)
+
+	y -= 14
+	page.Line(certificateMargin, y, certificateRight, y, 1)
+
+	// advance moves y down to the next baseline, starting a new page when it
+	// would fall below the bottom margin. continued, when set, writes what
+	// has to be repeated at the top of the new page.
+	var continued func()
+	advance := func(dy float64) {
+		y -= dy
+		if y >= certificateBottom {
+			return
+		}
+		page = doc.AddPage()
+		pages = append(pages, page)
+		y = pdf.PageHeight - certificateMargin - 10
+		if continued != nil {
+			continued()
+		}
+	}
+
+	field := func(label, value string) {
+		for i, line := range wrapText(value, pdf.Regular, 10, certificateRight-certificateMargin-130) {
+			if i == 0 {
+				advance(20)
+				page.Text(certificateMargin, y, pdf.Bold, 10, label)
+			} else {
+				advance(14)
+			}
+			page.Text(certificateMargin+130, y, pdf.Regular, 10, line)
+		}
+	}
+
+	y -= 10
+	field("Scale", fs.Model)
+	field("Scale ID", strconv.FormatInt(fs.ID, 10))
+	if fs.SKU != nil {
+		field("SKU", *fs.SKU)
+	}
+	if fs.GTIN != nil {
+		field("GTIN", *fs.GTIN)
+	}
+	field("Calibrated on", c.CalibratedOn.String())
+	field("Technician", c.Technician)
+	field("Next calibration due", c.NextDueOn.String())
+
+	result := "FAIL"
+	if c.Passed {
+		result = "PASS"
+	}
+
+	advance(30)
+	page.Rect(certificateMargin, y-10, certificateRight-certificateMargin, 30, 0.92)
+	page.Text(certificateMargin+10, y, pdf.Bold, 14, "Result: "+result)
+
+	// Test weights, with the numeric columns aligned on the right.
+	columns := []struct {
+		title string
+		right float64
+	}{
+		{"Test weight (g)", 100},
+		{"Measured (g)", 200},
+		{"Deviation (g)", 300},
+		{"Tolerance (g)", 400},
+		{"Result", certificateRight - certificateMargin},
+	}
+
+	row := func(font pdf.Font, values []string) {
+		for i, value := range values {
+			x := certificateMargin + columns[i].right - pdf.Width(font, 10, value)
+			page.Text(x, y, font, 10, value)
+		}
+	}
+
+	titles := make([]string, len(columns))
+	for i, column := range columns {
+		titles[i] = column.title
+	}
+	header := func() {
+		row(pdf.Bold, titles)
+		y -= 6
+		page.Line(certificateMargin, y, certificateRight, y, 0.5)
+	}
+
+	advance(45)
+	header()
+
+	// A table split over pages gets its header again, with the first row
+	// of the page at the usual distance below it.
+	continued = func() {
+		header()
+		y -= 16
+	}
+
+	for _, t := range c.Tests {
+		advance(16)
+		passed := "fail"
+		if t.Passed {
+			passed = "pass"
+		}
+		row(pdf.Regular, []string{
+			formatGrams(t.NominalGrams),
+			formatGrams(t.MeasuredGrams),
+			fmt.Sprintf("%+.3f", t.DeviationGrams),
+			"±" + formatGrams(t.ToleranceGrams),
+			passed,
+		})
+	}
+
+	continued = nil
+
+	if c.Notes != "" {
+		advance(30)
+		page.Text(certificateMargin, y, pdf.Bold, 10, "Notes")
+		for _, line := range wrapText(c.Notes, pdf.Regular, 10, certificateRight-certificateMargin) {
+			advance(14)
+			page.Text(certificateMargin, y, pdf.Regular, 10, line)
+		}
+	}
+
+	recorded := fmt.Sprintf("Recorded %s. Issued %s.", c.CreatedAt.UTC().Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
+	for i, p := range pages {
+		footer := recorded
+		if len(pages) > 1 {
+			footer = fmt.Sprintf("%s Page %d of %d.", recorded, i+1, len(pages))
+		}
+		p.Line(certificateMargin, certificateMargin+14, certificateRight, certificateMargin+14, 0.5)
+		p.Text(certificateMargin, certificateMargin, pdf.Regular, 8, footer)
+	}
+
+	var buf bytes.Buffer
+	_, err := doc.WriteTo(&buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func formatGrams(g float64) string {
+	return strconv.FormatFloat(g, 'f', -1, 64)
+}
+
+// wrapText breaks text into lines no wider than width, keeping the line
+// breaks it already has. Words too wide for a line of their own are split.
+func wrapText(text string, font pdf.Font, size, width float64) []string {
+	var lines []string
+
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for _, part := range splitWord(word, font, size, width) {
+				candidate := part
+				if line != "" {
+					candidate = line + " " + part
+				}
+				if line != "" && pdf.Width(font, size, candidate) > width {
+					lines = append(lines, line)
+					candidate = part
+				}
+				line = candidate
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitWord cuts word into pieces no wider than width.
+func splitWord(word string, font pdf.Font, size, width float64) []string {
+	var parts []string
+
+	part := ""
+	for _, r := range word {
+		if part != "" && pdf.Width(font, size, part+string(r)) > width {
+			parts = append(parts, part)
+			part = ""
+		}
+		part += string(r)
+	}
+	return append(parts, part)
+}
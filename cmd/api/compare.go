@@ -0,0 +1,196 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	minCompareScales = 2
+	maxCompareScales = 5
+)
+
+// comparedAttribute describes one row of the comparison matrix. score, when
+// set, orders the values so the best one can be marked; higher is better.
+type comparedAttribute struct {
+	name  string
+	value func(*data.FoodScales) interface{}
+	score func(*data.FoodScales) float64
+}
+
+var comparedAttributes = []comparedAttribute{
+	{name: "model", value: func(fs *data.FoodScales) interface{} { return fs.Model }},
+	{
+		name:  "price",
+		value: func(fs *data.FoodScales) interface{} { return fs.Price },
+		score: func(fs *data.FoodScales) float64 { return -float64(fs.Price) },
+	},
+	{
+		name:  "year",
+		value: func(fs *data.FoodScales) interface{} { return fs.Year },
+		score: func(fs *data.FoodScales) float64 { return float64(fs.Year) },
+	},
+	{
+		name:  "runtime",
+		value: func(fs *data.FoodScales) interface{} { return fs.Runtime },
+		score: func(fs *data.FoodScales) float64 { return float64(fs.Runtime) },
+	},
+	{name: "dimensions", value: func(fs *data.FoodScales) interface{} { return fs.Dimensions }},
+	{name: "manufacturer_id", value: func(fs *data.FoodScales) interface{} { return fs.ManufacturerID }},
+	{name: "sku", value: func(fs *data.FoodScales) interface{} { return fs.SKU }},
+	{name: "gtin", value: func(fs *data.FoodScales) interface{} { return fs.GTIN }},
+}
+
+type comparisonRow struct {
+	Attribute string        `json:"attribute"`
+	Values    []interface{} `json:"values"`
+	Best      []int64       `json:"best,omitempty"`
+	Differs   bool          `json:"differs"`
+}
+
+type comparison struct {
+	IDs       []int64         `json:"ids"`
+	Rows      []comparisonRow `json:"rows"`
+	Differing []string        `json:"differing"`
+}
+
+// compareFoodScales lays the scales out as an attribute matrix whose columns
+// follow the order of the scales. For attributes with a natural order the ids
+// of the scales holding the best value are listed, as long as the values
+// differ at all.
+func compareFoodScales(foodscales []*data.FoodScales) (*comparison, error) {
+	c := &comparison{IDs: make([]int64, len(foodscales)), Differing: []string{}}
+	for i, fs := range foodscales {
+		c.IDs[i] = fs.ID
+	}
+
+	for _, attribute := range comparedAttributes {
+		row := comparisonRow{Attribute: attribute.name, Values: make([]interface{}, len(foodscales))}
+
+		var first []byte
+		for i, fs := range foodscales {
+			row.Values[i] = attribute.value(fs)
+
+			js, err := json.Marshal(row.Values[i])
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				first = js
+			} else if string(js) != string(first) {
+				row.Differs = true
+			}
+		}
+
+		if row.Differs && attribute.score != nil {
+			best := attribute.score(foodscales[0])
+			for _, fs := range foodscales[1:] {
+				if score := attribute.score(fs); score > best {
+					best = score
+				}
+			}
+			for _, fs := range foodscales {
+				if attribute.score(fs) == best {
+					row.Best = append(row.Best, fs.ID)
+				}
+			}
+		}
+
+		if row.Differs {
+			c.Differing = append(c.Differing, attribute.name)
+		}
+		c.Rows = append(c.Rows, row)
+	}
+
+	return c, nil
+}
+
+func (app *application) compareFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	rawIDs := app.readCSV(qs, "ids", nil)
+
+	ids := make([]int64, 0, len(rawIDs))
+	seen := make(map[int64]bool)
+	for _, raw := range rawIDs {
+		id, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+		if err != nil || id < 1 {
+			v.AddError("ids", "must be a comma-separated list of scale ids")
+			break
+		}
+		if seen[id] {
+			v.AddError("ids", "must not contain duplicate ids")
+			break
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	v.Check(len(rawIDs) >= minCompareScales, "ids", fmt.Sprintf("must contain at least %d ids", minCompareScales))
+	v.Check(len(rawIDs) <= maxCompareScales, "ids", fmt.Sprintf("must not contain more than %d ids", maxCompareScales))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	found, err := app.models.FoodScales.GetForIDs(ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	byID := make(map[int64]*data.FoodScales, len(found))
+	for _, fs := range found {
+		byID[fs.ID] = fs
+	}
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	foodscales := make([]*data.FoodScales, 0, len(ids))
+	missing := []string{}
+	for _, id := range ids {
+		fs, ok := byID[id]
+		if ok && visibleTo != 0 {
+			role, err := app.models.ACL.RoleForUser(id, visibleTo)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			ok = role != ""
+		}
+		if !ok {
+			missing = append(missing, strconv.FormatInt(id, 10))
+			continue
+		}
+		foodscales = append(foodscales, fs)
+	}
+
+	if len(missing) > 0 {
+		v.AddError("ids", "no scales found with ids "+strings.Join(missing, ", "))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	c, err := compareFoodScales(foodscales)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"comparison": c, "foodscales": foodscales}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,7 +8,11 @@ import (
 
 type contextKey string
 
-const userContextKey = contextKey("user")
+const (
+	userContextKey      = contextKey("user")
+	deviceContextKey    = contextKey("device")
+	requestIDContextKey = contextKey("request_id")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -22,3 +26,25 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+func (app *application) contextSetDevice(r *http.Request, device *data.Device) *http.Request {
+	ctx := context.WithValue(r.Context(), deviceContextKey, device)
+	return r.WithContext(ctx)
+}
+
+// contextGetDevice returns the device the request is authenticated as, or nil
+// when it was not sent by a device.
+func (app *application) contextGetDevice(r *http.Request) *data.Device {
+	device, _ := r.Context().Value(deviceContextKey).(*data.Device)
+	return device
+}
+
+func (app *application) contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetRequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDContextKey).(string)
+	return requestID
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/protocol"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func (app *application) createDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FoodScaleID int64  `json:"foodscale_id"`
+		Name        string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	device := &data.Device{
+		UserID:      app.contextGetUser(r).ID,
+		FoodScaleID: input.FoodScaleID,
+		Name:        input.Name,
+	}
+
+	v := validator.New()
+	if data.ValidateDevice(v, device); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// A device writes readings for its scale, so registering one takes the
+	// editor role. Scales the user holds no role on are treated as missing.
+	permissions, err := app.models.Permissions.GetAllForUser(device.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permissions.Include("scales:admin") {
+		role, err := app.models.ACL.RoleForUser(device.FoodScaleID, device.UserID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		switch {
+		case role == "":
+			v.AddError("foodscale_id", "must refer to an existing scale")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		case !data.RoleIncludes(role, data.RoleEditor):
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	credential, err := app.models.Devices.Insert(device)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("foodscale_id", "must refer to an existing scale")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "device.create", ResourceType: data.AuditResourceDevice, ResourceID: &device.ID}, nil, device)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/devices/%d", device.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"device": device, "credential": credential.Plaintext}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortSafelist = []string{"id", "name", "last_seen_at", "-id", "-name", "-last_seen_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	devices, metadata, err := app.models.Devices.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"devices": devices, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnDevice loads the device named by the :id parameter if it belongs to
+// the user. It returns nil when a response has been written.
+func (app *application) readOwnDevice(w http.ResponseWriter, r *http.Request) *data.Device {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	device, err := app.models.Devices.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return device
+}
+
+func (app *application) showDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.readOwnDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"device": device}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.readOwnDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	before := *device
+
+	var input struct {
+		Name *string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		device.Name = *input.Name
+	}
+
+	v := validator.New()
+	if data.ValidateDevice(v, device); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Devices.Update(device)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "device.update", ResourceType: data.AuditResourceDevice, ResourceID: &device.ID}, before, device)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteDeviceHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.readOwnDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	err := app.models.Devices.Delete(device.ID, device.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "device.delete", ResourceType: data.AuditResourceDevice, ResourceID: &device.ID}, device, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "device successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// rotateDeviceCredentialHandler issues a new credential for the device. The
+// previous one stops working immediately.
+func (app *application) rotateDeviceCredentialHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.readOwnDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	credential, err := app.models.Devices.RotateCredential(device)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "device.rotate_credential", ResourceType: data.AuditResourceDevice, ResourceID: &device.ID}, nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"device": device, "credential": credential.Plaintext}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// ingestReadingsHandler stores a batch of readings sent by the authenticated
+// device. Readings it has sent before are reported as duplicates rather than
+// rejected, so a device can safely send a batch again when it did not get an
+// answer.
+//
+// Devices that relay a scale's raw output can send it as frames instead, each
+// a base64 payload in one of the formats of the protocol package. A frame
+// without a plausible time stamp of its own is taken as recorded at its
+// received_at, or now. Frames reporting an overload or similar state are
+// skipped.
+func (app *application) ingestReadingsHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.contextGetDevice(r)
+
+	var input struct {
+		Readings []data.Reading `json:"readings"`
+		Frames   []struct {
+			Format     string     `json:"format"`
+			Payload    []byte     `json:"payload"`
+			ReceivedAt *time.Time `json:"received_at"`
+		} `json:"frames"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	v := validator.New()
+
+	v.Check(len(input.Readings)+len(input.Frames) > 0, "readings", "must contain at least one reading or frame")
+	v.Check(len(input.Readings)+len(input.Frames) <= data.MaxReadingsPerBatch, "readings", fmt.Sprintf("must not contain more than %d readings and frames", data.MaxReadingsPerBatch))
+
+	readings := make([]data.Reading, 0, len(input.Readings)+len(input.Frames))
+	skipped := 0
+
+	for i, reading := range input.Readings {
+		data.ValidateReading(v, fmt.Sprintf("readings[%d]", i), reading, now)
+		readings = append(readings, reading)
+	}
+
+	for i, frame := range input.Frames {
+		key := fmt.Sprintf("frames[%d]", i)
+
+		m, err := protocol.Decode(frame.Format, frame.Payload)
+		if err != nil {
+			switch {
+			case errors.Is(err, protocol.ErrNoWeight):
+				skipped++
+			default:
+				v.AddError(key, err.Error())
+			}
+			continue
+		}
+
+		// Scales whose clock was never set send timestamps far off the
+		// mark, for which the time the frame was received is a better
+		// guess than rejecting the batch.
+		if m.Timestamp != nil && !data.ReadingTimePlausible(*m.Timestamp, now) {
+			m.Timestamp = nil
+		}
+
+		receivedAt := now
+		if frame.ReceivedAt != nil {
+			receivedAt = *frame.ReceivedAt
+		}
+
+		reading := m.Reading(receivedAt)
+		data.ValidateReading(v, key, reading, now)
+		readings = append(readings, reading)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	result := &data.IngestResult{}
+	if len(readings) > 0 {
+		result, err = app.models.Readings.Insert(device.ID, readings)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	result.Skipped = skipped
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"result": result}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listReadingsHandler returns the device's readings between from and to, 24
+// hours up to now by default. With interval set, for example "1m" or "1h",
+// the readings are downsampled into buckets of that length; otherwise they
+// are returned as recorded, up to limit at a time.
+func (app *application) listReadingsHandler(w http.ResponseWriter, r *http.Request) {
+	device := app.readOwnDevice(w, r)
+	if device == nil {
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := data.ReadingQuery{
+		DeviceID:   device.ID,
+		To:         time.Now(),
+		StableOnly: app.readBool(qs, "stable", false, v),
+	}
+	if to := app.readTime(qs, "to", v); to != nil {
+		q.To = *to
+	}
+	q.From = q.To.Add(-24 * time.Hour)
+	if from := app.readTime(qs, "from", v); from != nil {
+		q.From = *from
+	}
+	v.Check(q.From.Before(q.To), "from", "must be before to")
+
+	var interval time.Duration
+	if s := app.readString(qs, "interval", ""); s != "" {
+		var err error
+		interval, err = time.ParseDuration(s)
+		switch {
+		case err != nil:
+			v.AddError("interval", "must be a duration such as 30s, 5m or 1h")
+		case interval < time.Second || interval%time.Second != 0:
+			v.AddError("interval", "must be a whole number of seconds")
+		case q.To.Sub(q.From)/interval > data.MaxReadingBuckets:
+			v.AddError("interval", fmt.Sprintf("must not split the range into more than %d buckets", data.MaxReadingBuckets))
+		}
+	}
+
+	limit := app.readInt(qs, "limit", 1000, v)
+	v.Check(limit > 0 && limit <= data.MaxReadingsPerQuery, "limit", fmt.Sprintf("must be between 1 and %d", data.MaxReadingsPerQuery))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if interval > 0 {
+		buckets, err := app.models.Readings.GetBuckets(q, interval)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"buckets": buckets, "interval": interval.String(), "from": q.From, "to": q.To}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	readings, more, err := app.models.Readings.GetRange(q, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"readings": readings, "more": more, "from": q.From, "to": q.To}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// foodScaleETag derives a strong entity tag from the scale's version, which
+// changes on every update, and its rating aggregates, which change with
+// reviews without the version moving.
+func foodScaleETag(foodscales *data.FoodScales) string {
+	return fmt.Sprintf(`"%d-%d-%s"`, foodscales.ID, foodscales.Version, ratingTag(foodscales))
+}
+
+func ratingTag(foodscales *data.FoodScales) string {
+	if foodscales.RatingAvg == nil {
+		return "0"
+	}
+	return fmt.Sprintf("%d-%.2f", foodscales.RatingCount, *foodscales.RatingAvg)
+}
+
+// foodScalesListETag derives a strong entity tag for a page of scales from the
+// ids, versions and ratings on the page, the pagination metadata and the facet counts,
+// which can change when scales on other pages do.
+func foodScalesListETag(foodscales []*data.FoodScales, metadata data.Metadata, facets *data.Facets) string {
+	h := sha256.New()
+	for _, fs := range foodscales {
+		fmt.Fprintf(h, "%d:%d:%s;", fs.ID, fs.Version, ratingTag(fs))
+	}
+	fmt.Fprintf(h, "%d:%d:%d;", metadata.CurrentPage, metadata.PageSize, metadata.TotalRecords)
+	json.NewEncoder(h).Encode(facets)
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches reports whether etag is listed in an If-Match or If-None-Match
+// header value. Weak comparison ignores the W/ prefix and is what
+// If-None-Match uses, If-Match requires strong comparison.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfNoneMatch answers a conditional GET with 304 Not Modified when the
+// client already holds the current representation. It returns true when the
+// response has been written.
+func (app *application) checkIfNoneMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatches(header, etag, true) {
+		return false
+	}
+	w.Header().Set("ETag", etag)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// checkIfMatch rejects a conditional write with 412 Precondition Failed when
+// the client's copy is not the current one. It returns true when the
+// response has been written.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" || etagMatches(header, etag, false) {
+		return false
+	}
+	app.preconditionFailedResponse(w, r)
+	return true
+}
@@ -0,0 +1,539 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxExportedScales caps how many scales of a single list go into an export.
+// Lists holding more are refused rather than cut short.
+const maxExportedScales = 10000
+
+// csvCell keeps spreadsheet applications from running a value as a formula by
+// quoting values that start with a character a formula can start with.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func (app *application) readListedFoodScaleFilters(qs url.Values, v *validator.Validator) data.Filters {
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "-added_at"),
+		SortSafelist: data.ListedFoodScaleSortSafelist,
+	}
+
+	data.ValidateFilters(v, filters)
+	return filters
+}
+
+func (app *application) listFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	filters := app.readListedFoodScaleFilters(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	favorites, metadata, err := app.models.Favorites.GetAll(user.ID, visibleTo, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"favorites": favorites, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.checkFoodScaleRole(w, r, id, data.RoleViewer) {
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	addedAt, err := app.models.Favorites.Add(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"favorite": envelope{"foodscale_id": id, "added_at": addedAt}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeFavoriteHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.Favorites.Remove(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "scale successfully removed from favorites"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listWatchlistsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	watchlists, err := app.models.Watchlists.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watchlists": watchlists}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	watchlist := &data.Watchlist{UserID: user.ID, Name: input.Name}
+
+	v := validator.New()
+	if data.ValidateWatchlist(v, watchlist); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Watchlists.Insert(watchlist)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateWatchlistName):
+			v.AddError("name", "you already have a watchlist with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "watchlist.create", ResourceType: data.AuditResourceWatchlist, ResourceID: &watchlist.ID}, nil, watchlist)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/users/me/watchlists/%d", watchlist.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"watchlist": watchlist}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readOwnWatchlist loads the watchlist named by the :id parameter if it
+// belongs to the current user. Other users' watchlists are reported as not
+// found. It returns nil when a response has been written.
+func (app *application) readOwnWatchlist(w http.ResponseWriter, r *http.Request) *data.Watchlist {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	user := app.contextGetUser(r)
+
+	watchlist, err := app.models.Watchlists.Get(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+	return watchlist
+}
+
+func (app *application) showWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	watchlist := app.readOwnWatchlist(w, r)
+	if watchlist == nil {
+		return
+	}
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeWatchlist(w, r, watchlist, visibleTo)
+}
+
+// showSharedWatchlistHandler lets anyone holding a share link read the
+// watchlist, without signing in. The items are limited to the scales its
+// owner can currently see.
+func (app *application) showSharedWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	watchlist, err := app.models.Watchlists.GetForShareToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	visibleTo, err := app.foodScaleVisibleToUser(watchlist.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The owner is not shown to people who only hold the link.
+	public := *watchlist
+	public.UserID = 0
+
+	app.writeWatchlist(w, r, &public, visibleTo)
+}
+
+func (app *application) writeWatchlist(w http.ResponseWriter, r *http.Request, watchlist *data.Watchlist, visibleTo int64) {
+	v := validator.New()
+
+	filters := app.readListedFoodScaleFilters(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := app.models.Watchlists.GetItems(watchlist.ID, visibleTo, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watchlist": watchlist, "items": items, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	watchlist := app.readOwnWatchlist(w, r)
+	if watchlist == nil {
+		return
+	}
+
+	err := app.models.Watchlists.Delete(watchlist.ID, watchlist.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "watchlist.delete", ResourceType: data.AuditResourceWatchlist, ResourceID: &watchlist.ID}, watchlist, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "watchlist successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	watchlist := app.readOwnWatchlist(w, r)
+	if watchlist == nil {
+		return
+	}
+
+	foodscaleID, err := app.readInt64Param(r, "scaleID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.checkFoodScaleRole(w, r, foodscaleID, data.RoleViewer) {
+		return
+	}
+
+	addedAt, err := app.models.Watchlists.AddItem(watchlist.ID, foodscaleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"item": envelope{"foodscale_id": foodscaleID, "added_at": addedAt}}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeWatchlistItemHandler(w http.ResponseWriter, r *http.Request) {
+	watchlist := app.readOwnWatchlist(w, r)
+	if watchlist == nil {
+		return
+	}
+
+	foodscaleID, err := app.readInt64Param(r, "scaleID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Watchlists.RemoveItem(watchlist.ID, foodscaleID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "scale successfully removed from watchlist"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// shareWatchlistHandler creates a share link for the watchlist. Sharing again
+// replaces the link, so an old link can be revoked by rotating it.
+func (app *application) shareWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	watchlist := app.readOwnWatchlist(w, r)
+	if watchlist == nil {
+		return
+	}
+
+	token, err := data.GenerateShareToken()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Watchlists.SetShareToken(watchlist, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "watchlist.share", ResourceType: data.AuditResourceWatchlist, ResourceID: &watchlist.ID}, nil, nil)
+
+	share := envelope{
+		"token": token.Plaintext,
+		"url":   fmt.Sprintf("/v1/watchlists/shared/%s", token.Plaintext),
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"watchlist": watchlist, "share": share}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) unshareWatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	watchlist := app.readOwnWatchlist(w, r)
+	if watchlist == nil {
+		return
+	}
+
+	err := app.models.Watchlists.SetShareToken(watchlist, nil)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "watchlist.unshare", ResourceType: data.AuditResourceWatchlist, ResourceID: &watchlist.ID}, nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"watchlist": watchlist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// exportFavoritesHandler returns the user's favorites and watchlists in one
+// download, as JSON or, with format=csv, as one row per listed scale.
+func (app *application) exportFavoritesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	format := app.readString(r.URL.Query(), "format", "json")
+	if v.Check(validator.In(format, "json", "csv"), "format", "must be json or csv"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	filters := data.Filters{Page: 1, PageSize: maxExportedScales, Sort: "added_at", SortSafelist: data.ListedFoodScaleSortSafelist}
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	favorites, metadata, err := app.models.Favorites.GetAll(user.ID, visibleTo, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if metadata.TotalRecords > maxExportedScales {
+		app.exportTooLargeResponse(w, r, "favorites")
+		return
+	}
+
+	watchlists, err := app.models.Watchlists.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	type exportedWatchlist struct {
+		*data.Watchlist
+		Items []*data.ListedFoodScale `json:"items"`
+	}
+
+	exported := make([]exportedWatchlist, len(watchlists))
+	for i, watchlist := range watchlists {
+		items, metadata, err := app.models.Watchlists.GetItems(watchlist.ID, visibleTo, filters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if metadata.TotalRecords > maxExportedScales {
+			app.exportTooLargeResponse(w, r, strconv.Quote(watchlist.Name))
+			return
+		}
+		exported[i] = exportedWatchlist{Watchlist: watchlist, Items: items}
+	}
+
+	filename := fmt.Sprintf("scales-lists-%s.%s", time.Now().UTC().Format("20060102"), format)
+
+	if format == "json" {
+		headers := make(http.Header)
+		headers.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		err = app.writeJSON(w, http.StatusOK, envelope{"favorites": favorites, "watchlists": exported}, headers)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"list", "foodscale_id", "model", "price", "sku", "gtin", "added_at"})
+
+	writeRows := func(list string, items []*data.ListedFoodScale) {
+		for _, item := range items {
+			sku, gtin := "", ""
+			if item.FoodScale.SKU != nil {
+				sku = *item.FoodScale.SKU
+			}
+			if item.FoodScale.GTIN != nil {
+				gtin = *item.FoodScale.GTIN
+			}
+			cw.Write([]string{
+				csvCell(list),
+				strconv.FormatInt(item.FoodScale.ID, 10),
+				csvCell(item.FoodScale.Model),
+				strconv.FormatFloat(float64(item.FoodScale.Price), 'f', -1, 32),
+				csvCell(sku),
+				csvCell(gtin),
+				item.AddedAt.UTC().Format(time.RFC3339),
+			})
+		}
+	}
+
+	writeRows("favorites", favorites)
+	for _, watchlist := range exported {
+		writeRows(watchlist.Name, watchlist.Items)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		app.logError(r, err)
+	}
+}
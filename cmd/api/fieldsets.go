@@ -0,0 +1,175 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// foodScaleIncludes lists the related resources that can be embedded in a
+// scale with include=.
+var foodScaleIncludes = []string{"manufacturer", "latest_price"}
+
+// foodScaleView describes how scales are rendered: which of their fields are
+// kept and which related resources are embedded. The zero value renders the
+// full scale.
+type foodScaleView struct {
+	Fields  []string
+	Include []string
+}
+
+func (app *application) readFoodScaleView(qs url.Values, v *validator.Validator) foodScaleView {
+	view := foodScaleView{
+		Fields:  app.readCSV(qs, "fields", nil),
+		Include: app.readCSV(qs, "include", nil),
+	}
+
+	data.ValidateFoodScaleFields(v, view.Fields)
+	for _, include := range view.Include {
+		v.Check(validator.In(include, foodScaleIncludes...), "include", fmt.Sprintf("unknown relation %q", include))
+	}
+	return view
+}
+
+func (view foodScaleView) includes(relation string) bool {
+	return validator.In(relation, view.Include...)
+}
+
+// columns returns the fields that have to be read from the database to render
+// the view. Embedding the manufacturer needs its id even when the client did
+// not ask for it.
+func (view foodScaleView) columns() []string {
+	if len(view.Fields) == 0 || !view.includes("manufacturer") || validator.In("manufacturer_id", view.Fields...) {
+		return view.Fields
+	}
+	return append(append([]string{}, view.Fields...), "manufacturer_id")
+}
+
+// renderFoodScales returns the scales as they should be written for the view,
+// or the scales themselves when the view is the full representation.
+func (app *application) renderFoodScales(foodscales []*data.FoodScales, view foodScaleView) (interface{}, error) {
+	if len(view.Fields) == 0 && len(view.Include) == 0 {
+		return foodscales, nil
+	}
+
+	var manufacturers map[int64]*data.Manufacturer
+	var prices map[int64]*data.PriceChange
+
+	if view.includes("manufacturer") {
+		ids := []int64{}
+		for _, fs := range foodscales {
+			if fs.ManufacturerID != nil {
+				ids = append(ids, *fs.ManufacturerID)
+			}
+		}
+
+		var err error
+		manufacturers, err = app.models.Manufacturers.GetForIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if view.includes("latest_price") {
+		ids := make([]int64, len(foodscales))
+		for i, fs := range foodscales {
+			ids[i] = fs.ID
+		}
+
+		var err error
+		prices, err = app.models.FoodScaleVersions.LatestPriceForIDs(ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rendered := make([]map[string]interface{}, len(foodscales))
+
+	for i, fs := range foodscales {
+		js, err := json.Marshal(fs)
+		if err != nil {
+			return nil, err
+		}
+
+		var all map[string]json.RawMessage
+		err = json.Unmarshal(js, &all)
+		if err != nil {
+			return nil, err
+		}
+
+		item := make(map[string]interface{})
+		for key, value := range all {
+			if len(view.Fields) == 0 || validator.In(key, view.Fields...) || key == "highlight" {
+				item[key] = value
+			}
+		}
+
+		if view.includes("manufacturer") {
+			var manufacturer *data.Manufacturer
+			if fs.ManufacturerID != nil {
+				manufacturer = manufacturers[*fs.ManufacturerID]
+			}
+			item["manufacturer"] = manufacturer
+		}
+		if view.includes("latest_price") {
+			item["latest_price"] = prices[fs.ID]
+		}
+
+		rendered[i] = item
+	}
+
+	return rendered, nil
+}
+
+// renderFoodScale renders a single scale for the view.
+func (app *application) renderFoodScale(foodscales *data.FoodScales, view foodScaleView) (interface{}, error) {
+	rendered, err := app.renderFoodScales([]*data.FoodScales{foodscales}, view)
+	if err != nil {
+		return nil, err
+	}
+	if items, ok := rendered.([]map[string]interface{}); ok {
+		return items[0], nil
+	}
+	return foodscales, nil
+}
+
+// etag qualifies the entity tag of the full representation with the fields
+// kept, since a sparse fieldset is a representation of its own. The fields
+// are sorted and deduplicated first, so the same selection written in another
+// order shares the tag.
+func (view foodScaleView) etag(full string) string {
+	if len(view.Fields) == 0 {
+		return full
+	}
+
+	fields := append([]string{}, view.Fields...)
+	sort.Strings(fields)
+
+	normalized := fields[:1]
+	for _, field := range fields[1:] {
+		if field != normalized[len(normalized)-1] {
+			normalized = append(normalized, field)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(full + ";" + strings.Join(normalized, ",")))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// renderedETag derives an entity tag from a rendered representation. It is
+// used when related resources are embedded, because those can change without
+// the scale's version moving.
+func renderedETag(rendered interface{}) (string, error) {
+	js, err := json.Marshal(rendered)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(js)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
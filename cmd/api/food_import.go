@@ -0,0 +1,347 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	foodImportBatchSize = 500
+
+	// foodImportMaxLine bounds a line of a JSONL dump, whose products can
+	// carry large ingredient and image lists.
+	foodImportMaxLine = 16 << 20
+
+	// foodImportLoggedSkips is how many skipped products are logged with
+	// their reason before only the count is kept.
+	foodImportLoggedSkips = 20
+)
+
+// Food dump formats accepted by importFoods.
+const (
+	foodFormatAuto  = "auto"
+	foodFormatCSV   = "csv"
+	foodFormatJSONL = "jsonl"
+)
+
+// offProduct is a product of an Open Food Facts dump, reduced to the fields
+// the import uses. Nutriment values are looked up by their dump field name,
+// such as "saturated-fat_100g".
+type offProduct struct {
+	code       string
+	name       string
+	brands     string
+	nutriments func(field string) (float64, bool)
+}
+
+// importFoods loads the foods of an Open Food Facts dump from a local file,
+// either the CSV export, which is tab-separated, or the JSONL one, optionally
+// gzip-compressed. Foods are matched to the stored ones by code, so a newer
+// dump updates them in place. Products without a code or name, or with
+// values that fail validation, are skipped; nutrient amounts that are not
+// possible are dropped.
+func (app *application) importFoods(path, format string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+
+	name := strings.ToLower(path)
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+		name = strings.TrimSuffix(name, ".gz")
+	}
+
+	if format == foodFormatAuto {
+		switch filepath.Ext(name) {
+		case ".csv", ".tsv":
+			format = foodFormatCSV
+		case ".jsonl", ".ndjson", ".json":
+			format = foodFormatJSONL
+		default:
+			return fmt.Errorf("cannot tell the format of %s from its extension, set it explicitly", path)
+		}
+	}
+
+	total := &data.FoodImportResult{}
+	skipped := 0
+	batch := make([]*data.Food, 0, foodImportBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := app.models.Foods.Import(batch)
+		if err != nil {
+			return err
+		}
+		total.Inserted += result.Inserted
+		total.Updated += result.Updated
+		total.Unchanged += result.Unchanged
+		batch = batch[:0]
+		return nil
+	}
+
+	add := func(line int, product offProduct) error {
+		food, err := product.food()
+		if err != nil {
+			skipped++
+			if skipped <= foodImportLoggedSkips {
+				app.logger.PrintInfo("skipped product", map[string]string{"line": strconv.Itoa(line), "code": product.code, "reason": err.Error()})
+			}
+			return nil
+		}
+
+		batch = append(batch, food)
+		if len(batch) < foodImportBatchSize {
+			return nil
+		}
+		return flush()
+	}
+
+	switch format {
+	case foodFormatCSV:
+		err = readOFFCSV(r, add)
+	case foodFormatJSONL:
+		err = readOFFJSONL(r, add)
+	default:
+		return fmt.Errorf("unknown food dump format %q", format)
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return err
+	}
+
+	app.logger.PrintInfo("imported foods", map[string]string{
+		"file":      path,
+		"inserted":  strconv.Itoa(total.Inserted),
+		"updated":   strconv.Itoa(total.Updated),
+		"unchanged": strconv.Itoa(total.Unchanged),
+		"skipped":   strconv.Itoa(skipped),
+	})
+	return nil
+}
+
+// food converts the product to a food. Amounts in the dump are per 100 g and
+// in grams, apart from energy, which is in kcal or, failing that, kJ.
+func (p offProduct) food() (*data.Food, error) {
+	code := strings.TrimSpace(p.code)
+	if code == "" {
+		return nil, errors.New("no code")
+	}
+
+	food := &data.Food{
+		Code:      &code,
+		Name:      strings.Join(strings.Fields(p.name), " "),
+		Nutrients: map[string]float64{},
+	}
+
+	brand, _, _ := strings.Cut(p.brands, ",")
+	food.Brand = strings.Join(strings.Fields(brand), " ")
+
+	for _, n := range data.Nutrients {
+		amount, ok := p.nutriments(strings.ReplaceAll(n.Key, "_", "-") + "_100g")
+		if n.UnitsPerGram == 0 && !ok {
+			amount, ok = p.nutriments("energy_100g")
+			amount /= 4.184
+		}
+		if !ok {
+			continue
+		}
+
+		if n.UnitsPerGram > 0 {
+			amount *= n.UnitsPerGram
+		}
+		amount = math.Round(amount*10000) / 10000
+
+		if n.Valid(amount) {
+			food.Nutrients[n.Key] = amount
+		}
+	}
+
+	v := validator.New()
+	if data.ValidateFood(v, food); !v.Valid() {
+		for field, message := range v.Errors {
+			return nil, fmt.Errorf("%s %s", field, message)
+		}
+	}
+	return food, nil
+}
+
+// readOFFCSV reads the Open Food Facts CSV export. Despite its name it is
+// tab-separated without any quoting, so a quote is an ordinary character;
+// files separated by commas are read as standard CSV.
+func readOFFCSV(r io.Reader, fn func(line int, product offProduct) error) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+
+	header, err := br.ReadString('\n')
+	if err != nil && header == "" {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	header = strings.TrimRight(header, "\r\n")
+
+	var columns []string
+	var next func() ([]string, error)
+
+	if strings.Contains(header, "\t") {
+		columns = strings.Split(header, "\t")
+		next = func() ([]string, error) {
+			line, err := br.ReadString('\n')
+			if line == "" {
+				return nil, err
+			}
+			return strings.Split(strings.TrimRight(line, "\r\n"), "\t"), nil
+		}
+	} else {
+		cr := csv.NewReader(io.MultiReader(strings.NewReader(header+"\n"), br))
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+
+		columns, err = cr.Read()
+		if err != nil {
+			return fmt.Errorf("reading header: %w", err)
+		}
+		next = cr.Read
+	}
+
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[strings.TrimSpace(column)] = i
+	}
+	if _, ok := index["code"]; !ok {
+		return errors.New("the header has no code column")
+	}
+
+	for line := 2; ; line++ {
+		record, err := next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		get := func(column string) string {
+			i, ok := index[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+
+		product := offProduct{
+			code:   get("code"),
+			name:   firstNonEmpty(get("product_name"), get("product_name_en"), get("generic_name")),
+			brands: get("brands"),
+			nutriments: func(field string) (float64, bool) {
+				return parseNutriment(get(field))
+			},
+		}
+
+		err = fn(line, product)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readOFFJSONL reads the Open Food Facts JSONL export, one product per line.
+func readOFFJSONL(r io.Reader, fn func(line int, product offProduct) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1<<20), foodImportMaxLine)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var input struct {
+			Code          interface{}            `json:"code"`
+			ProductName   string                 `json:"product_name"`
+			ProductNameEN string                 `json:"product_name_en"`
+			GenericName   string                 `json:"generic_name"`
+			Brands        string                 `json:"brands"`
+			Nutriments    map[string]interface{} `json:"nutriments"`
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+
+		err := dec.Decode(&input)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		// Codes are strings, but some older dumps have them as numbers.
+		code := ""
+		if input.Code != nil {
+			code = fmt.Sprint(input.Code)
+		}
+
+		product := offProduct{
+			code:   code,
+			name:   firstNonEmpty(input.ProductName, input.ProductNameEN, input.GenericName),
+			brands: input.Brands,
+			nutriments: func(field string) (float64, bool) {
+				switch value := input.Nutriments[field].(type) {
+				case json.Number:
+					return parseNutriment(value.String())
+				case string:
+					return parseNutriment(value)
+				default:
+					return 0, false
+				}
+			},
+		}
+
+		err = fn(line, product)
+		if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func parseNutriment(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func (app *application) createFoodHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code      *string            `json:"code"`
+		Name      string             `json:"name"`
+		Brand     string             `json:"brand"`
+		Nutrients map[string]float64 `json:"nutrients"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	food := &data.Food{
+		Code:      input.Code,
+		Name:      input.Name,
+		Brand:     input.Brand,
+		Nutrients: input.Nutrients,
+	}
+
+	v := validator.New()
+	if data.ValidateFood(v, food); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Foods.Insert(food)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFoodCode):
+			v.AddError("code", "a food with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "food.create", ResourceType: data.AuditResourceFood, ResourceID: &food.ID}, nil, food)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/foods/%d", food.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"food": food}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showFoodHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	food, err := app.models.Foods.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"food": food}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateFoodHandler changes the given fields of a food. Nutrients, when
+// given, replace all of the food's nutrients.
+func (app *application) updateFoodHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	food, err := app.models.Foods.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *food
+
+	var input struct {
+		Code      *string             `json:"code"`
+		Name      *string             `json:"name"`
+		Brand     *string             `json:"brand"`
+		Nutrients *map[string]float64 `json:"nutrients"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Code != nil {
+		food.Code = input.Code
+	}
+	if input.Name != nil {
+		food.Name = *input.Name
+	}
+	if input.Brand != nil {
+		food.Brand = *input.Brand
+	}
+	if input.Nutrients != nil {
+		food.Nutrients = *input.Nutrients
+	}
+
+	v := validator.New()
+	if data.ValidateFood(v, food); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Foods.Update(food)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateFoodCode):
+			v.AddError("code", "a food with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "food.update", ResourceType: data.AuditResourceFood, ResourceID: &food.ID}, before, food)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"food": food}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteFoodHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	food, err := app.models.Foods.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Foods.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "food.delete", ResourceType: data.AuditResourceFood, ResourceID: &id}, food, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "food successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listFoodsHandler lists foods, searching their names when name is given.
+// Search results are sorted by relevance unless another sort is asked for.
+func (app *application) listFoodsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.FoodQuery
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.FoodQuery.Name = app.readString(qs, "name", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	defaultSort := "name"
+	if input.FoodQuery.Name != "" {
+		defaultSort = "relevance"
+	}
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
+	input.Filters.SortSafelist = []string{"id", "name", "brand", "relevance", "-id", "-name", "-brand"}
+
+	data.ValidateFoodQuery(v, input.FoodQuery)
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	foods, metadata, err := app.models.Foods.GetAll(input.FoodQuery, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"foods": foods, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// calculateNutritionHandler returns the nutrients in a weighed portion of a
+// food, scaled from the food's amounts per 100 g.
+func (app *application) calculateNutritionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		FoodID int64   `json:"food_id"`
+		Grams  float64 `json:"grams"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.FoodID > 0, "food_id", "must be provided")
+	v.Check(input.Grams > 0, "grams", "must be greater than zero")
+	v.Check(input.Grams <= data.MaxNutritionGrams, "grams", fmt.Sprintf("must not be more than %d", data.MaxNutritionGrams))
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	food, err := app.models.Foods.Get(input.FoodID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("food_id", "must refer to an existing food")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	nutrition := envelope{
+		"food":      food,
+		"grams":     input.Grams,
+		"nutrients": food.Calculate(input.Grams),
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"nutrition": nutrition}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
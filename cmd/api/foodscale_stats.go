@@ -0,0 +1,68 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// readFoodScaleQuery reads the search and filter parameters shared by the
+// endpoints that work on a selection of the catalogue.
+func (app *application) readFoodScaleQuery(qs url.Values, v *validator.Validator) data.FoodScaleQuery {
+	q := data.FoodScaleQuery{
+		Model:          app.readString(qs, "model", ""),
+		Year:           app.readInt(qs, "year", 0, v),
+		MinPrice:       app.readFloat(qs, "min_price", 0, v),
+		MaxPrice:       app.readFloat(qs, "max_price", 0, v),
+		ManufacturerID: int64(app.readInt(qs, "manufacturer_id", 0, v)),
+		InStock:        app.readBool(qs, "in_stock", false, v),
+		LocationID:     int64(app.readInt(qs, "location_id", 0, v)),
+	}
+
+	data.ValidateFoodScaleQuery(v, q)
+	return q
+}
+
+func (app *application) showFoodScaleStatsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	q := app.readFoodScaleQuery(qs, v)
+	groupBy := app.readString(qs, "group_by", "")
+
+	if groupBy != "" {
+		groups := make([]string, 0, len(data.StatsGroups))
+		for group := range data.StatsGroups {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+
+		v.Check(validator.In(groupBy, groups...), "group_by", "must be one of "+strings.Join(groups, ", "))
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	q.VisibleTo = visibleTo
+
+	stats, err := app.models.FoodScales.GetStats(q, groupBy)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -5,18 +5,23 @@ import (
 	"awesomeProject3/internal/validator"
 	"errors"
 	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"mime"
 	"net/http"
 )
 
 func (app *application) newFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Model      string       `json:"model" `
-		Version    int64        `json:"version"`
-		Price      float32      `json:"price"`
-		Year       int32        `json:"year" `
-		Dimensions []float32    `json:"dimensions" `
-		Runtime    data.Runtime `json:"runtime" `
+		Model          string       `json:"model" `
+		Version        int64        `json:"version"`
+		Price          float32      `json:"price"`
+		Year           int32        `json:"year" `
+		Dimensions     []float32    `json:"dimensions" `
+		Runtime        data.Runtime `json:"runtime" `
+		SKU            *string      `json:"sku"`
+		GTIN           *string      `json:"gtin"`
+		ManufacturerID *int64       `json:"manufacturer_id"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -25,11 +30,20 @@ func (app *application) newFoodScalesHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	user := app.contextGetUser(r)
+
 	foodscale := &data.FoodScales{
-		Model:      input.Model,
-		Year:       input.Year,
-		Runtime:    input.Runtime,
-		Dimensions: input.Dimensions,
+		Model:          input.Model,
+		Version:        int32(input.Version),
+		Price:          input.Price,
+		Year:           input.Year,
+		Runtime:        input.Runtime,
+		Dimensions:     input.Dimensions,
+		CreatedBy:      &user.ID,
+		OwnerUserID:    &user.ID,
+		SKU:            input.SKU,
+		GTIN:           input.GTIN,
+		ManufacturerID: input.ManufacturerID,
 	}
 
 	v := validator.New()
@@ -40,10 +54,24 @@ func (app *application) newFoodScalesHandler(w http.ResponseWriter, r *http.Requ
 	}
 	err = app.models.FoodScales.Insert(foodscale)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a scale with this sku already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateGTIN):
+			v.AddError("gtin", "a scale with this gtin already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownManufacturer):
+			v.AddError("manufacturer_id", "must refer to an existing manufacturer")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	app.audit(r, &data.AuditEvent{Action: "foodscale.create", ResourceType: data.AuditResourceFoodScale, ResourceID: &foodscale.ID}, nil, foodscale)
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/scales/%d", foodscale.ID))
 
@@ -61,6 +89,14 @@ func (app *application) showFoodScalesHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	v := validator.New()
+
+	view := app.readFoodScaleView(r.URL.Query(), v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	foodscales, err := app.models.FoodScales.Get(id)
 	if err != nil {
 		switch {
@@ -72,7 +108,67 @@ func (app *application) showFoodScalesHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, nil)
+	app.writeFoodScale(w, r, foodscales, view)
+}
+
+// showFoodScaleByGTINHandler looks a scale up by a scanned barcode. UPC-A and
+// EAN-13 codes find the scale as well as its GTIN-14.
+func (app *application) showFoodScaleByGTINHandler(w http.ResponseWriter, r *http.Request) {
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	v := validator.New()
+
+	view := app.readFoodScaleView(r.URL.Query(), v)
+	data.ValidateGTIN(v, &code)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	foodscales, err := app.models.FoodScales.GetByGTIN(code)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.checkFoodScaleRole(w, r, foodscales.ID, data.RoleViewer) {
+		return
+	}
+
+	app.writeFoodScale(w, r, foodscales, view)
+}
+
+// writeFoodScale renders the scale for the view and answers conditional
+// requests with its entity tag.
+func (app *application) writeFoodScale(w http.ResponseWriter, r *http.Request, foodscales *data.FoodScales, view foodScaleView) {
+	rendered, err := app.renderFoodScale(foodscales, view)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag := view.etag(foodScaleETag(foodscales))
+	if len(view.Include) > 0 {
+		etag, err = renderedETag(rendered)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if app.checkIfNoneMatch(w, r, etag) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": rendered}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -96,32 +192,141 @@ func (app *application) updateFoodScalesHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	var input struct {
-		Model      *string       `json:"model" `
-		Year       *int32        `json:"year" `
-		Runtime    *data.Runtime `json:"runtime" `
-		Dimensions []float32     `json:"dimensions" `
+	if app.checkIfMatch(w, r, foodScaleETag(foodscales)) {
+		return
 	}
 
-	err = app.readJSON(w, r, &input)
+	before := *foodscales
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch contentType {
+	case mergePatchContentType, jsonPatchContentType:
+		if !app.patchFoodScales(w, r, contentType, foodscales) {
+			return
+		}
+
+	case "", "application/json":
+		var input struct {
+			Model          *string       `json:"model" `
+			Price          *float32      `json:"price"`
+			Year           *int32        `json:"year" `
+			Runtime        *data.Runtime `json:"runtime" `
+			Dimensions     []float32     `json:"dimensions" `
+			SKU            *string       `json:"sku"`
+			GTIN           *string       `json:"gtin"`
+			ManufacturerID *int64        `json:"manufacturer_id"`
+		}
+
+		err = app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Model != nil {
+			foodscales.Model = *input.Model
+		}
+		if input.Price != nil {
+			foodscales.Price = *input.Price
+		}
+		if input.Year != nil {
+			foodscales.Year = *input.Year
+		}
+		if input.Runtime != nil {
+			foodscales.Runtime = *input.Runtime
+		}
+		if input.Dimensions != nil {
+			foodscales.Dimensions = input.Dimensions
+		}
+		if input.SKU != nil {
+			foodscales.SKU = input.SKU
+		}
+		if input.GTIN != nil {
+			foodscales.GTIN = input.GTIN
+		}
+		if input.ManufacturerID != nil {
+			foodscales.ManufacturerID = input.ManufacturerID
+		}
+
+	default:
+		app.unsupportedMediaTypeResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateFoodScales(v, foodscales); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.FoodScales.Update(foodscales)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a scale with this sku already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateGTIN):
+			v.AddError("gtin", "a scale with this gtin already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownManufacturer):
+			v.AddError("manufacturer_id", "must refer to an existing manufacturer")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	if input.Model != nil {
-		foodscales.Model = *input.Model
+	app.audit(r, &data.AuditEvent{Action: "foodscale.update", ResourceType: data.AuditResourceFoodScale, ResourceID: &id}, before, foodscales)
+
+	headers := make(http.Header)
+	headers.Set("ETag", foodScaleETag(foodscales))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 	}
-	if input.Year != nil {
-		foodscales.Year = *input.Year
+}
+
+// replaceFoodScalesHandler implements PUT: the body is the complete editable
+// document and fields left out are cleared rather than kept.
+func (app *application) replaceFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	foodscales, err := app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
-	if input.Runtime != nil {
-		foodscales.Runtime = *input.Runtime
+
+	if app.checkIfMatch(w, r, foodScaleETag(foodscales)) {
+		return
 	}
-	if input.Dimensions != nil {
-		foodscales.Dimensions = input.Dimensions
+
+	before := *foodscales
+
+	var input foodScaleDocument
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
+	input.applyTo(foodscales)
+
 	v := validator.New()
 	if data.ValidateFoodScales(v, foodscales); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
@@ -131,6 +336,15 @@ func (app *application) updateFoodScalesHandler(w http.ResponseWriter, r *http.R
 	err = app.models.FoodScales.Update(foodscales)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrDuplicateSKU):
+			v.AddError("sku", "a scale with this sku already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateGTIN):
+			v.AddError("gtin", "a scale with this gtin already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownManufacturer):
+			v.AddError("manufacturer_id", "must refer to an existing manufacturer")
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -139,7 +353,144 @@ func (app *application) updateFoodScalesHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, nil)
+	app.audit(r, &data.AuditEvent{Action: "foodscale.replace", ResourceType: data.AuditResourceFoodScale, ResourceID: &id}, before, foodscales)
+
+	headers := make(http.Header)
+	headers.Set("ETag", foodScaleETag(foodscales))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// errUpsertAborted rolls back an upsert whose response has already been
+// written.
+var errUpsertAborted = errors.New("upsert aborted")
+
+// upsertFoodScalesBySKUHandler creates or fully replaces the scale with the
+// SKU from the URL, so that a sync job can safely send the same request again.
+func (app *application) upsertFoodScalesBySKUHandler(w http.ResponseWriter, r *http.Request) {
+	sku := httprouter.ParamsFromContext(r.Context()).ByName("sku")
+
+	v := validator.New()
+	if data.ValidateSKU(v, sku); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input foodScaleDocument
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.SKU != nil && *input.SKU != sku {
+		v.AddError("sku", "must match the sku in the URL")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var existing *data.FoodScales
+	var created bool
+
+	foodscales := &data.FoodScales{
+		Version:     1,
+		CreatedBy:   &user.ID,
+		OwnerUserID: &user.ID,
+	}
+
+	// The row is locked before the role check, trashed or not, so neither a
+	// concurrent write nor bringing a trashed scale back can slip past it.
+	err = app.models.FoodScales.Transaction(func(scales data.FoodScaleModel) error {
+		existing, err = scales.LockBySKU(sku)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			return err
+		}
+
+		if existing != nil {
+			if !permissions.Include("scales:admin") {
+				role, err := scales.RoleForUser(existing.ID, user.ID)
+				if err != nil {
+					return err
+				}
+				switch {
+				case role == "":
+					app.notFoundResponse(w, r)
+					return errUpsertAborted
+				case !data.RoleIncludes(role, data.RoleEditor):
+					app.notPermittedResponse(w, r)
+					return errUpsertAborted
+				}
+			}
+
+			if app.checkIfMatch(w, r, foodScaleETag(existing)) {
+				return errUpsertAborted
+			}
+
+			copied := *existing
+			foodscales = &copied
+		}
+
+		input.SKU = &sku
+		input.applyTo(foodscales)
+
+		if data.ValidateFoodScales(v, foodscales); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return errUpsertAborted
+		}
+
+		if existing == nil {
+			// A scale created with the SKU since the lookup makes this
+			// fail rather than silently replacing it.
+			created = true
+			return scales.Insert(foodscales)
+		}
+
+		created, err = scales.Upsert(foodscales)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errUpsertAborted):
+			// The response has already been written.
+		case errors.Is(err, data.ErrDuplicateSKU):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateGTIN):
+			v.AddError("gtin", "a scale with this gtin already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrUnknownManufacturer):
+			v.AddError("manufacturer_id", "must refer to an existing manufacturer")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", foodScaleETag(foodscales))
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/scales/%d", foodscales.ID))
+		app.audit(r, &data.AuditEvent{Action: "foodscale.create", ResourceType: data.AuditResourceFoodScale, ResourceID: &foodscales.ID}, nil, foodscales)
+	} else if existing == nil || existing.Version != foodscales.Version {
+		app.audit(r, &data.AuditEvent{Action: "foodscale.replace", ResourceType: data.AuditResourceFoodScale, ResourceID: &foodscales.ID}, existing, foodscales)
+	}
+
+	err = app.writeJSON(w, status, envelope{"foodscales": foodscales}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -153,6 +504,21 @@ func (app *application) deleteFoodScalesHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	foodscales, err := app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if app.checkIfMatch(w, r, foodScaleETag(foodscales)) {
+		return
+	}
+
 	err = app.models.FoodScales.Delete(id)
 	if err != nil {
 		switch {
@@ -164,7 +530,9 @@ func (app *application) deleteFoodScalesHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "foodscales successfully deleted"}, nil)
+	app.audit(r, &data.AuditEvent{Action: "foodscale.delete", ResourceType: data.AuditResourceFoodScale, ResourceID: &id}, foodscales, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "foodscales successfully moved to trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -173,26 +541,95 @@ func (app *application) deleteFoodScalesHandler(w http.ResponseWriter, r *http.R
 func (app *application) listFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Model string
+		data.FoodScaleQuery
 		data.Filters
 	}
 	v := validator.New()
 	qs := r.URL.Query()
 
-	input.Model = app.readString(qs, "model", "")
+	input.FoodScaleQuery = app.readFoodScaleQuery(qs, v)
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.FoodScaleQuery.VisibleTo = visibleTo
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
-	input.Filters.SortSafelist = []string{"id", "model", "year", "runtime", "-id", "-model", "-year", "-runtime"}
+	input.Filters.SortSafelist = []string{"id", "model", "year", "runtime", "relevance", "rating_avg", "rating_count", "-id", "-model", "-year", "-runtime", "-rating_avg", "-rating_count"}
+
+	view := app.readFoodScaleView(qs, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	foodscales, metadata, err := app.models.FoodScales.GetAll(input.FoodScaleQuery, view.columns(), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	facets, err := app.models.FoodScales.GetFacets(input.FoodScaleQuery)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	rendered, err := app.renderFoodScales(foodscales, view)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	etag := view.etag(foodScalesListETag(foodscales, metadata, facets))
+	if len(view.Include) > 0 {
+		etag, err = renderedETag(envelope{"foodscales": rendered, "metadata": metadata, "facets": facets})
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if app.checkIfNoneMatch(w, r, etag) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": rendered, "metadata": metadata, "facets": facets}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+func (app *application) listDeletedFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	input.Filters.SortSafelist = []string{"id", "model", "deleted_at", "-id", "-model", "-deleted_at"}
 
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	foodscales, metadata, err := app.models.FoodScales.GetAll(input.Model, input.Filters)
+	foodscales, metadata, err := app.models.FoodScales.GetDeleted(input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -202,5 +639,36 @@ func (app *application) listFoodScalesHandler(w http.ResponseWriter, r *http.Req
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
+}
+
+func (app *application) undeleteFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.FoodScales.Undelete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	foodscales, err := app.models.FoodScales.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "foodscale.undelete", ResourceType: data.AuditResourceFoodScale, ResourceID: &id}, nil, foodscales)
 
+	err = app.writeJSON(w, http.StatusOK, envelope{"foodscales": foodscales}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
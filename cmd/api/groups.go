@@ -0,0 +1,121 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) createGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{Name: input.Name}
+
+	v := validator.New()
+	if data.ValidateGroup(v, group); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.Insert(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGroupName):
+			v.AddError("name", "a group with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "group.create", ResourceType: data.AuditResourceGroup, ResourceID: &group.ID}, nil, group)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if v.Check(input.UserID > 0, "user_id", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.AddUser(id, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "group.add_member", ResourceType: data.AuditResourceGroup, ResourceID: &id}, nil, map[string]int64{"user_id": input.UserID})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully added to group"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	userID, err := app.readInt64Param(r, "userID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Groups.RemoveUser(id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "group.remove_member", ResourceType: data.AuditResourceGroup, ResourceID: &id}, map[string]int64{"user_id": userID}, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "user successfully removed from group"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -11,18 +11,23 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readInt64Param(r, "id")
+}
+
+func (app *application) readInt64Param(r *http.Request, name string) (int64, error) {
 
 	params := httprouter.ParamsFromContext(r.Context())
 
-	serverID, err := strconv.ParseInt(params.ByName("serverID"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 
-	if err != nil || serverID < 1 {
-		return 0, errors.New("invalid serverID parameter")
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
-	return serverID, nil
+	return id, nil
 }
 
 type envelope map[string]interface{}
@@ -45,9 +50,12 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// maxJSONBodyBytes is the largest request body readJSON accepts.
+const maxJSONBodyBytes = 1_048_576
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
 
-	maxBytes := 1_048_576
+	maxBytes := maxJSONBodyBytes
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
 	dec := json.NewDecoder(r.Body)
@@ -128,6 +136,45 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readFloat(qs url.Values, key string, defaultValue float64, v *validator.Validator) float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+	return f
+}
+
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+	return b
+}
+
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return nil
+	}
+	return &t
+}
+
 func (app *application) background(fn func()) {
 
 	app.wg.Add(1)
@@ -142,3 +189,24 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// foodScaleVisibleTo returns the user whose scales a listing is restricted
+// to, for FoodScaleQuery.VisibleTo. Users with the scales:admin permission
+// see every scale, which is returned as zero.
+func (app *application) foodScaleVisibleTo(r *http.Request) (int64, error) {
+	return app.foodScaleVisibleToUser(app.contextGetUser(r).ID)
+}
+
+// foodScaleVisibleToUser is foodScaleVisibleTo for a user other than the one
+// making the request, such as the owner of a shared watchlist.
+func (app *application) foodScaleVisibleToUser(userID int64) (int64, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return 0, err
+	}
+
+	if permissions.Include("scales:admin") {
+		return 0, nil
+	}
+	return userID, nil
+}
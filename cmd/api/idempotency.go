@@ -0,0 +1,174 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// replayedHeaders lists the response headers stored with an idempotent
+// response and sent again on replay.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// captureWriter passes a response through to the client while keeping a copy
+// of its status and body.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.body.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// idempotent makes POST requests carrying an Idempotency-Key header safe to
+// retry. The first response for a key is stored per user, or per device for
+// connected scales, and replayed for identical retries until it expires.
+// Reusing a key for a different request is rejected. Anonymous callers have
+// no identity to scope their keys by, so theirs are scoped by the client IP
+// and the request itself: only an identical retry from the same address
+// shares the stored response.
+//
+// It wraps individual routes after their authentication and permission
+// checks, so nothing is buffered for callers that would be turned away, and
+// maxBytes should be the limit the route itself puts on its body. Routes whose
+// responses carry credentials must not be wrapped, since the response is
+// stored as it was sent.
+func (app *application) idempotent(maxBytes int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errors.New("Idempotency-Key must not be more than 255 bytes long"))
+			return
+		}
+
+		user := app.contextGetUser(r)
+		device := app.contextGetDevice(r)
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+		if err != nil {
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				app.badRequestResponse(w, r, fmt.Errorf("body must not be larger than %d bytes", maxBytes))
+				return
+			}
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+		hash.Write(body)
+
+		req := &data.IdempotentRequest{
+			UserID:      user.ID,
+			Key:         key,
+			RequestHash: hash.Sum(nil),
+			ExpiresAt:   time.Now().Add(app.config.idempotency.ttl),
+		}
+		switch {
+		case device != nil:
+			req.DeviceID = device.ID
+		case user.IsAnonymous():
+			ip, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				ip = r.RemoteAddr
+			}
+			scope := sha256.New()
+			fmt.Fprintf(scope, "%s\n%x\n%s", ip, req.RequestHash, key)
+			req.Key = hex.EncodeToString(scope.Sum(nil))
+		}
+
+		reserved, existing, err := app.models.Idempotency.Reserve(req)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !reserved {
+			switch {
+			case !bytes.Equal(existing.RequestHash, req.RequestHash):
+				app.idempotencyKeyReusedResponse(w, r)
+			case !existing.Completed:
+				app.idempotencyKeyInProgressResponse(w, r)
+			default:
+				for _, name := range replayedHeaders {
+					if value := existing.Header.Get(name); value != "" {
+						w.Header().Set(name, value)
+					}
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(existing.Status)
+				w.Write(existing.Body)
+			}
+			return
+		}
+
+		cw := &captureWriter{ResponseWriter: w}
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.releaseIdempotencyKey(r, req)
+				panic(err)
+			}
+		}()
+
+		next.ServeHTTP(cw, r)
+
+		if cw.status == 0 || cw.status >= 500 {
+			app.releaseIdempotencyKey(r, req)
+			return
+		}
+
+		req.Status = cw.status
+		req.Header = make(http.Header)
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				req.Header.Set(name, value)
+			}
+		}
+		req.Body = cw.body.Bytes()
+
+		err = app.models.Idempotency.Complete(req)
+		if err != nil {
+			app.logError(r, err)
+		}
+	}
+}
+
+func (app *application) releaseIdempotencyKey(r *http.Request, req *data.IdempotentRequest) {
+	err := app.models.Idempotency.Release(req.UserID, req.DeviceID, req.Key)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) purgeIdempotencyKeys() error {
+	_, err := app.models.Idempotency.DeleteExpired()
+	return err
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) showFoodScaleStockHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	_, err = app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	levels, err := app.models.Inventory.GetLevels(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	total := 0
+	for _, level := range levels {
+		total += level.OnHand
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stock": levels, "on_hand": total}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showLocationStockHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		InStock bool
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.InStock = app.readBool(qs, "in_stock", true, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Locations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	levels, metadata, err := app.models.Inventory.GetLevelsAtLocation(id, input.InStock, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"stock": levels, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listStockMovementsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		LocationID int64
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.LocationID = int64(app.readInt(qs, "location_id", 0, v))
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-created_at")
+	input.Filters.SortSafelist = data.StockMovementSortSafelist
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	movements, metadata, err := app.models.Inventory.GetMovements(id, input.LocationID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movements": movements, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createStockMovementHandler records a receipt, sale, adjustment or transfer
+// of the scale. Receipts, sales and transfers take a positive quantity and
+// the ledger stores it with the sign of the change; adjustments take the
+// signed change directly and need a note. A transfer moves the quantity from
+// location_id to to_location_id.
+func (app *application) createStockMovementHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Kind         string `json:"kind"`
+		LocationID   int64  `json:"location_id"`
+		ToLocationID int64  `json:"to_location_id"`
+		Quantity     int    `json:"quantity"`
+		Reference    string `json:"reference"`
+		Note         string `json:"note"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	var movements []*data.StockMovement
+
+	switch input.Kind {
+	case "transfer":
+		v.Check(input.Quantity > 0, "quantity", "must be positive")
+		v.Check(input.LocationID > 0, "location_id", "must be provided")
+		v.Check(input.ToLocationID > 0, "to_location_id", "must be provided")
+		v.Check(input.ToLocationID != input.LocationID, "to_location_id", "must differ from location_id")
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		movements, err = app.models.Inventory.NewTransfer(id, input.LocationID, input.ToLocationID, input.Quantity)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	case data.StockReceipt, data.StockSale, data.StockAdjustment:
+		v.Check(input.ToLocationID == 0, "to_location_id", "must only be given for transfers")
+
+		quantity := input.Quantity
+		if input.Kind == data.StockSale {
+			v.Check(quantity > 0, "quantity", "must be positive")
+			quantity = -quantity
+		}
+
+		movements = []*data.StockMovement{{FoodScaleID: id, LocationID: input.LocationID, Kind: input.Kind, Quantity: quantity}}
+	default:
+		// The halves of a transfer are only ever recorded together, through
+		// the transfer kind.
+		v.AddError("kind", "must be receipt, sale, adjustment or transfer")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	for _, movement := range movements {
+		movement.Reference = input.Reference
+		movement.Note = input.Note
+		movement.CreatedBy = &user.ID
+
+		data.ValidateStockMovement(v, movement)
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Inventory.Record(movements...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrUnknownLocation):
+			v.AddError("location_id", "must refer to an existing location")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrInsufficientStock):
+			app.insufficientStockResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "stock." + input.Kind, ResourceType: data.AuditResourceStock, ResourceID: &id}, nil, movements)
+
+	levels, err := app.models.Inventory.GetLevels(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"movements": movements, "stock": levels}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
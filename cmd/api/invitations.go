@@ -0,0 +1,208 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"net/http"
+	"time"
+)
+
+func (app *application) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	invitation := &data.Invitation{
+		Email:     input.Email,
+		Role:      input.Role,
+		InvitedBy: &user.ID,
+	}
+
+	v := validator.New()
+	if data.ValidateInvitation(v, invitation); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Inviting must not hand out more than the inviter holds.
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permissions.IncludeAll(data.InvitationRoles[invitation.Role]) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	token, err := app.models.Invitations.New(invitation, 7*24*time.Hour)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "invitation.create", ResourceType: data.AuditResourceInvitation, ResourceID: &invitation.ID}, nil, invitation)
+
+	app.background(func() {
+		data1 := map[string]interface{}{
+			"invitationToken": token.Plaintext,
+			"role":            invitation.Role,
+			"expiry":          invitation.Expiry.Format(time.RFC1123),
+		}
+		err := app.mailer.Send(invitation.Email, "user_invitation.tmpl", data1)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email  string
+		Status string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Email = app.readString(qs, "email", "")
+	input.Status = app.readString(qs, "status", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortSafelist = []string{"id", "email", "created_at", "expiry", "-id", "-email", "-created_at", "-expiry"}
+
+	if input.Status != "" {
+		v.Check(validator.In(input.Status, data.InvitationPending, data.InvitationAccepted, data.InvitationRevoked, data.InvitationExpired), "status", "invalid status value")
+	}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitations, metadata, err := app.models.Invitations.GetAll(input.Email, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"invitations": invitations, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) revokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Invitations.Revoke(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "invitation.revoke", ResourceType: data.AuditResourceInvitation, ResourceID: &id}, nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "invitation successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Name           string `json:"name"`
+		Password       string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	invitation, err := app.models.Invitations.GetForToken(input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid, expired or revoked invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := &data.User{
+		Name:      input.Name,
+		Email:     invitation.Email,
+		Activated: true,
+	}
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Invitations.Accept(invitation, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{ActorID: &user.ID, Action: "invitation.accept", ResourceType: data.AuditResourceInvitation, ResourceID: &invitation.ID}, nil, invitation)
+	app.audit(r, &data.AuditEvent{ActorID: &user.ID, Action: "user.create", ResourceType: data.AuditResourceUser, ResourceID: &user.ID}, nil, user)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
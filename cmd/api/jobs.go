@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// runPeriodically calls fn every interval in its own goroutine until the
+// server shuts down. Errors and panics are logged and do not stop the loop. A
+// non-positive interval disables the job. The goroutine is tracked by app.wg,
+// so shutdown waits for a run in progress to finish rather than cutting it
+// off mid-transaction.
+func (app *application) runPeriodically(name string, interval time.Duration, fn func() error) {
+	if interval <= 0 {
+		return
+	}
+
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.stopping:
+				return
+			case <-ticker.C:
+			}
+
+			func() {
+				defer func() {
+					if err := recover(); err != nil {
+						app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"job": name})
+					}
+				}()
+				err := fn()
+				if err != nil {
+					app.logger.PrintError(err, map[string]string{"job": name})
+				}
+			}()
+		}
+	}()
+}
+
+func (app *application) purgeTrash() error {
+	cutoff := time.Now().Add(-app.config.trash.retention)
+
+	keys, err := app.models.Attachments.BlobKeysForTrashedBefore(cutoff)
+	if err != nil {
+		return err
+	}
+
+	purged, err := app.models.FoodScales.PurgeDeleted(cutoff)
+	if err != nil {
+		return err
+	}
+
+	// Purging cascades to the attachments. Their blobs are removed unless a
+	// scale was undeleted in the meantime and still refers to them.
+	if len(keys) > 0 {
+		orphaned, err := app.models.Attachments.OrphanedBlobKeys(keys)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range orphaned {
+			err := app.blobs.Delete(context.Background(), key)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if purged > 0 {
+		app.logger.PrintInfo("purged scales from trash", map[string]string{
+			"count":  fmt.Sprint(purged),
+			"cutoff": cutoff.UTC().Format(time.RFC3339),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+func (app *application) createLocationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code    string `json:"code"`
+		Name    string `json:"name"`
+		Address string `json:"address"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	location := &data.Location{
+		Code:    input.Code,
+		Name:    input.Name,
+		Address: input.Address,
+	}
+
+	v := validator.New()
+	if data.ValidateLocation(v, location); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Locations.Insert(location)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateLocationCode):
+			v.AddError("code", "a location with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "location.create", ResourceType: data.AuditResourceLocation, ResourceID: &location.ID}, nil, location)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/locations/%d", location.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"location": location}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showLocationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	location, err := app.models.Locations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"location": location}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateLocationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	location, err := app.models.Locations.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *location
+
+	var input struct {
+		Code    *string `json:"code"`
+		Name    *string `json:"name"`
+		Address *string `json:"address"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Code != nil {
+		location.Code = *input.Code
+	}
+	if input.Name != nil {
+		location.Name = *input.Name
+	}
+	if input.Address != nil {
+		location.Address = *input.Address
+	}
+
+	v := validator.New()
+	if data.ValidateLocation(v, location); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Locations.Update(location)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateLocationCode):
+			v.AddError("code", "a location with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "location.update", ResourceType: data.AuditResourceLocation, ResourceID: &location.ID}, before, location)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"location": location}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listLocationsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "code")
+	input.Filters.SortSafelist = []string{"id", "code", "name", "-id", "-code", "-name"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	locations, metadata, err := app.models.Locations.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"locations": locations, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
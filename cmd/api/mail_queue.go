@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// mailLease is how long a claimed message is reserved for one delivery
+// attempt. It is well above the mailer's dial timeout.
+const mailLease = 2 * time.Minute
+
+// deliverQueuedMail sends the messages that are due on the mail queue. A
+// failed message is retried with an exponential backoff, capped at six hours,
+// until it has been tried mailQueue.maxAttempts times.
+func (app *application) deliverQueuedMail() error {
+	messages, err := app.models.MailQueue.Claim(app.config.mailQueue.batchSize, app.config.mailQueue.maxAttempts, mailLease)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		err := app.mailer.Send(message.Recipient, message.Template, message.Data)
+		if err == nil {
+			err = app.models.MailQueue.MarkSent(message.ID)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		app.logger.PrintError(err, map[string]string{
+			"mail_id":  fmt.Sprint(message.ID),
+			"template": message.Template,
+			"attempt":  fmt.Sprint(message.Attempts),
+		})
+
+		backoff := time.Duration(1<<uint(message.Attempts-1)) * time.Minute
+		if backoff > 6*time.Hour || backoff <= 0 {
+			backoff = 6 * time.Hour
+		}
+
+		err = app.models.MailQueue.MarkFailed(message.ID, err, time.Now().Add(backoff))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) purgeSentMail() error {
+	_, err := app.models.MailQueue.DeleteSent(time.Now().Add(-7 * 24 * time.Hour))
+	return err
+}
@@ -4,8 +4,11 @@ import (
 	"awesomeProject3/internal/data"
 	"awesomeProject3/internal/jsonlog"
 	"awesomeProject3/internal/mailer"
+	"awesomeProject3/internal/storage"
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"flag"
 	_ "github.com/golang-migrate/migrate/source/file"
 	_ "github.com/lib/pq"
@@ -41,6 +44,39 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	trash struct {
+		retention     time.Duration
+		purgeInterval time.Duration
+	}
+	idempotency struct {
+		ttl time.Duration
+	}
+	similar struct {
+		weights data.SimilarityWeights
+	}
+	mailQueue struct {
+		interval    time.Duration
+		batchSize   int
+		maxAttempts int
+	}
+	priceAlerts struct {
+		interval       time.Duration
+		digestInterval time.Duration
+	}
+	calibrations struct {
+		interval   time.Duration
+		remindDays int
+	}
+	foodImport struct {
+		file   string
+		format string
+	}
+	uploads struct {
+		dir        string
+		maxBytes   int64
+		signingKey string
+		urlTTL     time.Duration
+	}
 }
 
 type application struct {
@@ -48,7 +84,12 @@ type application struct {
 	logger *jsonlog.Logger
 	models data.Models
 	mailer mailer.Mailer
+	blobs  storage.BlobStore
 	wg     sync.WaitGroup
+
+	// stopping is closed when the server starts shutting down, telling
+	// periodic jobs not to start another run.
+	stopping chan struct{}
 }
 
 func main() {
@@ -79,6 +120,35 @@ func main() {
 		return nil
 	})
 
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted scales are kept before being purged")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often the trash is purged (0 disables purging)")
+
+	flag.DurationVar(&cfg.idempotency.ttl, "idempotency-ttl", 24*time.Hour, "How long responses to requests with an Idempotency-Key are kept")
+
+	flag.Float64Var(&cfg.similar.weights.Price, "similar-weight-price", data.DefaultSimilarityWeights.Price, "Default weight of price when ranking similar scales")
+	flag.Float64Var(&cfg.similar.weights.Year, "similar-weight-year", data.DefaultSimilarityWeights.Year, "Default weight of year when ranking similar scales")
+	flag.Float64Var(&cfg.similar.weights.Runtime, "similar-weight-runtime", data.DefaultSimilarityWeights.Runtime, "Default weight of runtime when ranking similar scales")
+	flag.Float64Var(&cfg.similar.weights.Dimensions, "similar-weight-dimensions", data.DefaultSimilarityWeights.Dimensions, "Default weight of dimensions when ranking similar scales")
+	flag.Float64Var(&cfg.similar.weights.Model, "similar-weight-model", data.DefaultSimilarityWeights.Model, "Default weight of model text similarity when ranking similar scales")
+
+	flag.DurationVar(&cfg.mailQueue.interval, "mail-queue-interval", 15*time.Second, "How often queued email is delivered")
+	flag.IntVar(&cfg.mailQueue.batchSize, "mail-queue-batch-size", 50, "Most queued emails sent per delivery run")
+	flag.IntVar(&cfg.mailQueue.maxAttempts, "mail-queue-max-attempts", 8, "How often sending a queued email is tried before giving up")
+
+	flag.DurationVar(&cfg.priceAlerts.interval, "price-alerts-interval", time.Minute, "How often fired price alerts are turned into emails (0 disables them)")
+	flag.DurationVar(&cfg.priceAlerts.digestInterval, "price-alerts-digest-interval", 24*time.Hour, "Shortest time between two price alert digests to the same user")
+
+	flag.DurationVar(&cfg.calibrations.interval, "calibrations-interval", time.Hour, "How often calibration reminders are queued (0 disables them)")
+	flag.IntVar(&cfg.calibrations.remindDays, "calibrations-remind-days", 14, "Days before a calibration falls due that its reminder is sent")
+
+	flag.StringVar(&cfg.foodImport.file, "import-foods", "", "Import foods from an Open Food Facts dump at this path, then exit")
+	flag.StringVar(&cfg.foodImport.format, "import-foods-format", foodFormatAuto, "Format of the food dump (auto|csv|jsonl)")
+
+	flag.StringVar(&cfg.uploads.dir, "uploads-dir", "./uploads", "Directory uploaded attachments are stored in")
+	flag.Int64Var(&cfg.uploads.maxBytes, "uploads-max-bytes", 10<<20, "Largest attachment accepted for upload")
+	flag.StringVar(&cfg.uploads.signingKey, "uploads-signing-key", os.Getenv("UPLOADS_SIGNING_KEY"), "Secret for signing attachment download links (random when empty)")
+	flag.DurationVar(&cfg.uploads.urlTTL, "uploads-url-ttl", 15*time.Minute, "How long signed attachment download links stay valid")
+
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -91,12 +161,46 @@ func main() {
 
 	logger.PrintInfo("database connection pool established", nil)
 
+	blobs, err := storage.NewFileSystem(cfg.uploads.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	if cfg.uploads.signingKey == "" {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		cfg.uploads.signingKey = hex.EncodeToString(key)
+		logger.PrintInfo("no uploads signing key set, download links will not survive a restart", nil)
+	}
+
 	app := &application{
 		config: cfg,
 		logger: logger,
 		models: data.NewModels(db),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		blobs:  blobs,
+
+		stopping: make(chan struct{}),
 	}
+
+	if cfg.foodImport.file != "" {
+		err = app.importFoods(cfg.foodImport.file, cfg.foodImport.format)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+		return
+	}
+
+	app.runPeriodically("purge trash", cfg.trash.purgeInterval, app.purgeTrash)
+	app.runPeriodically("purge idempotency keys", time.Hour, app.purgeIdempotencyKeys)
+	app.runPeriodically("deliver mail", cfg.mailQueue.interval, app.deliverQueuedMail)
+	app.runPeriodically("purge sent mail", time.Hour, app.purgeSentMail)
+	app.runPeriodically("queue price alerts", cfg.priceAlerts.interval, app.queuePriceAlertDigests)
+	app.runPeriodically("queue calibration reminders", cfg.calibrations.interval, app.queueCalibrationReminders)
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
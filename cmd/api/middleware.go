@@ -3,6 +3,8 @@ package main
 import (
 	"awesomeProject3/internal/data"
 	"awesomeProject3/internal/validator"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"golang.org/x/time/rate"
@@ -25,6 +27,27 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// requestID tags every request with an identifier, reusing the one sent by the
+// client or a proxy when present, and echoes it back in the response.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-Id")
+		if requestID == "" || len(requestID) > 128 {
+			randomBytes := make([]byte, 16)
+			_, err := rand.Read(randomBytes)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			requestID = hex.EncodeToString(randomBytes)
+		}
+
+		w.Header().Set("X-Request-Id", requestID)
+		r = app.contextSetRequestID(r, requestID)
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) rateLimit(next http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
@@ -86,6 +109,27 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
+
+		// Connected scales authenticate as themselves rather than as a user,
+		// so their credential is only good for the device endpoints.
+		if len(headerParts) == 2 && headerParts[0] == "Device" {
+			device, err := app.models.Devices.GetForCredential(headerParts[1])
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidDeviceCredentialResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			r = app.contextSetUser(r, data.AnonymousUser)
+			r = app.contextSetDevice(r, device)
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
@@ -129,6 +173,39 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+// requireDevice lets only requests authenticated with a device credential
+// through. A device writes on behalf of the user who registered it, so it is
+// turned away once that user no longer holds the editor role on its scale.
+func (app *application) requireDevice(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		device := app.contextGetDevice(r)
+		if device == nil {
+			app.invalidDeviceCredentialResponse(w, r)
+			return
+		}
+
+		permissions, err := app.models.Permissions.GetAllForUser(device.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !permissions.Include("scales:admin") {
+			role, err := app.models.ACL.RoleForUser(device.FoodScaleID, device.UserID)
+			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			if !data.RoleIncludes(role, data.RoleEditor) {
+				app.notPermittedResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -163,6 +240,64 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// requireFoodScaleRole checks that the user holds at least the given role on
+// the scale named by the :id parameter. It is meant to be wrapped by
+// requirePermission, which takes care of authentication and activation.
+func (app *application) requireFoodScaleRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		if !app.checkFoodScaleRole(w, r, id, role) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// checkFoodScaleRole reports whether the user holds at least role on the
+// scale, writing an error response when not. Scales the user holds no role on
+// at all are answered as not found, so their existence is not revealed.
+// Users with the scales:admin permission hold every role.
+func (app *application) checkFoodScaleRole(w http.ResponseWriter, r *http.Request, id int64, role string) bool {
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if permissions.Include("scales:admin") {
+		return true
+	}
+
+	have, err := app.models.ACL.RoleForUser(id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	switch {
+	case have == "":
+		app.notFoundResponse(w, r)
+		return false
+	case !data.RoleIncludes(have, role):
+		app.notPermittedResponse(w, r)
+		return false
+	}
+	return true
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -172,9 +307,10 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, X-Request-Id")
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, Idempotency-Key")
 						w.WriteHeader(http.StatusOK)
 						return
 					}
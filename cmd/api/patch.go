@@ -0,0 +1,134 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/jsonpatch"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// foodScaleDocument is the editable part of a scale as clients see it. Patches
+// are applied to this document rather than to the full representation so
+// that ids, versions and ownership cannot be patched.
+type foodScaleDocument struct {
+	Model          string       `json:"model"`
+	Price          float32      `json:"price"`
+	Year           int32        `json:"year,omitempty"`
+	Dimensions     []float32    `json:"dimensions,omitempty"`
+	Runtime        data.Runtime `json:"runtime,omitempty"`
+	SKU            *string      `json:"sku,omitempty"`
+	GTIN           *string      `json:"gtin,omitempty"`
+	ManufacturerID *int64       `json:"manufacturer_id,omitempty"`
+}
+
+func newFoodScaleDocument(foodscales *data.FoodScales) foodScaleDocument {
+	return foodScaleDocument{
+		Model:          foodscales.Model,
+		Price:          foodscales.Price,
+		Year:           foodscales.Year,
+		Dimensions:     foodscales.Dimensions,
+		Runtime:        foodscales.Runtime,
+		SKU:            foodscales.SKU,
+		GTIN:           foodscales.GTIN,
+		ManufacturerID: foodscales.ManufacturerID,
+	}
+}
+
+func (d foodScaleDocument) applyTo(foodscales *data.FoodScales) {
+	foodscales.Model = d.Model
+	foodscales.Price = d.Price
+	foodscales.Year = d.Year
+	foodscales.Dimensions = d.Dimensions
+	foodscales.Runtime = d.Runtime
+	foodscales.SKU = d.SKU
+	foodscales.GTIN = d.GTIN
+	foodscales.ManufacturerID = d.ManufacturerID
+}
+
+func (app *application) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	maxBytes := maxJSONBodyBytes
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+		}
+		return nil, err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, errors.New("body must not be empty")
+	}
+	return body, nil
+}
+
+// patchFoodScales applies a merge patch or JSON patch from the request body
+// to the scale. It writes the error response itself and reports whether the
+// scale was patched.
+func (app *application) patchFoodScales(w http.ResponseWriter, r *http.Request, contentType string, foodscales *data.FoodScales) bool {
+	body, err := app.readBody(w, r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+
+	doc, err := json.Marshal(newFoodScaleDocument(foodscales))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	var patched []byte
+	switch contentType {
+	case mergePatchContentType:
+		patched, err = jsonpatch.MergePatch(doc, body)
+	default:
+		patched, err = jsonpatch.Apply(doc, body)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.patchTestFailedResponse(w, r, err)
+		case errors.Is(err, jsonpatch.ErrPathNotFound):
+			app.invalidPatchResponse(w, r, err)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return false
+	}
+
+	var result foodScaleDocument
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(&result)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError):
+			app.invalidPatchResponse(w, r, fmt.Errorf("patched document contains incorrect JSON type for field %q", unmarshalTypeError.Field))
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			app.invalidPatchResponse(w, r, fmt.Errorf("patched document contains unknown key %s", fieldName))
+		case errors.Is(err, data.ErrInvalidRuntimeFormat):
+			app.invalidPatchResponse(w, r, fmt.Errorf("patched document contains an invalid runtime"))
+		default:
+			app.invalidPatchResponse(w, r, fmt.Errorf("patched document is invalid: %w", err))
+		}
+		return false
+	}
+
+	result.applyTo(foodscales)
+	return true
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const priceAlertDigestTemplate = "price_alert_digest.tmpl"
+
+// priceAlertUnsubscribeTTL is how long the unsubscribe token in a price alert
+// email stays valid.
+const priceAlertUnsubscribeTTL = 90 * 24 * time.Hour
+
+func (app *application) listPriceAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	alerts, err := app.models.PriceAlerts.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"price_alerts": alerts}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) setPriceAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		TargetPrice float64 `json:"target_price"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	alert := &data.PriceAlert{UserID: user.ID, FoodScaleID: id, TargetPrice: input.TargetPrice}
+
+	v := validator.New()
+	if data.ValidatePriceAlert(v, alert); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.PriceAlerts.Upsert(alert)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"price_alert": alert}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePriceAlertHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.PriceAlerts.Delete(user.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "price alert successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showPriceAlertSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	settings, err := app.models.PriceAlerts.GetSettings(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updatePriceAlertSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	settings, err := app.models.PriceAlerts.GetSettings(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		DailyDigest *bool `json:"daily_digest"`
+		Subscribed  *bool `json:"subscribed"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.DailyDigest != nil {
+		settings.DailyDigest = *input.DailyDigest
+	}
+	if input.Subscribed != nil {
+		settings.Subscribed = *input.Subscribed
+	}
+
+	err = app.models.PriceAlerts.UpdateSettings(user.ID, settings)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"settings": settings}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// unsubscribePriceAlertsHandler handles the unsubscribe token sent in every
+// price alert email, so it works without signing in.
+func (app *application) unsubscribePriceAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopePriceAlertUnsubscribe, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unsubscribe token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.PriceAlerts.Unsubscribe(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you will no longer receive price alert emails"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// queuePriceAlertDigests puts emails for fired price alerts on the mail
+// queue.
+func (app *application) queuePriceAlertDigests() error {
+	queued, err := app.models.PriceAlerts.QueueDigests(priceAlertDigestTemplate, app.config.priceAlerts.digestInterval, priceAlertUnsubscribeTTL)
+	if err != nil {
+		return err
+	}
+
+	if queued > 0 {
+		app.logger.PrintInfo("queued price alert emails", map[string]string{"count": fmt.Sprint(queued)})
+	}
+	return nil
+}
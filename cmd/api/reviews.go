@@ -0,0 +1,404 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// reviewETag derives a strong entity tag from the review's version.
+func reviewETag(review *data.Review) string {
+	return fmt.Sprintf(`"review-%d-%d"`, review.ID, review.Version)
+}
+
+func (app *application) canModerateReviews(r *http.Request) (bool, error) {
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include("reviews:moderate"), nil
+}
+
+// readReviewFilters reads the status and paging of a review listing. Any
+// status other than approved, or "all", is only for moderators.
+func (app *application) readReviewFilters(qs url.Values, defaultStatus string, v *validator.Validator) (string, data.Filters) {
+	status := app.readString(qs, "status", defaultStatus)
+	v.Check(status == "all" || validator.In(status, data.ReviewStatuses...), "status", "must be pending, approved, rejected or all")
+	if status == "all" {
+		status = ""
+	}
+
+	filters := data.Filters{
+		Page:         app.readInt(qs, "page", 1, v),
+		PageSize:     app.readInt(qs, "page_size", 20, v),
+		Sort:         app.readString(qs, "sort", "-created_at"),
+		SortSafelist: data.ReviewSortSafelist,
+	}
+
+	data.ValidateFilters(v, filters)
+	return status, filters
+}
+
+func (app *application) listFoodScaleReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	status, filters := app.readReviewFilters(r.URL.Query(), data.ReviewApproved, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	moderator, err := app.canModerateReviews(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if status != data.ReviewApproved && !moderator {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	_, err = app.models.FoodScales.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Authors always see their own reviews, whatever state they are in.
+	q := data.ReviewQuery{FoodScaleID: &id, Status: status, ViewerID: app.contextGetUser(r).ID}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(q, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listReviewsHandler is the moderation queue: reviews of every scale, pending
+// ones by default.
+func (app *application) listReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	status, filters := app.readReviewFilters(r.URL.Query(), data.ReviewPending, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAll(data.ReviewQuery{Status: status}, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"reviews": reviews, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createReviewHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Rating int    `json:"rating"`
+		Body   string `json:"body"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	review := &data.Review{
+		FoodScaleID: id,
+		UserID:      user.ID,
+		Rating:      input.Rating,
+		Body:        input.Body,
+		Status:      data.ReviewPending,
+	}
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateReview):
+			v.AddError("review", "you have already reviewed this scale")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "review.create", ResourceType: data.AuditResourceReview, ResourceID: &review.ID}, nil, review)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/scales/%d/reviews/%d", id, review.ID))
+	headers.Set("ETag", reviewETag(review))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readReview loads the review named by the :id and :reviewID parameters if
+// the current user may see it: approved reviews are public, others are only
+// visible to their author and to moderators. It also reports whether the user
+// is a moderator. The review is nil when a response has been written.
+func (app *application) readReview(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	reviewID, err := app.readInt64Param(r, "reviewID")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	review, err := app.models.Reviews.Get(id, reviewID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	moderator, err := app.canModerateReviews(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if review.Status != data.ReviewApproved && review.UserID != app.contextGetUser(r).ID && !moderator {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	return review, moderator
+}
+
+func (app *application) showReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, _ := app.readReview(w, r)
+	if review == nil {
+		return
+	}
+
+	etag := reviewETag(review)
+	if app.checkIfNoneMatch(w, r, etag) {
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateReviewHandler lets the author change their rating and text. An edited
+// review goes back to pending and drops out of the scale's rating until a
+// moderator approves it again.
+func (app *application) updateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, _ := app.readReview(w, r)
+	if review == nil {
+		return
+	}
+
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	if app.checkIfMatch(w, r, reviewETag(review)) {
+		return
+	}
+
+	before := *review
+
+	var input struct {
+		Rating *int    `json:"rating"`
+		Body   *string `json:"body"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+	review.Status = data.ReviewPending
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "review.update", ResourceType: data.AuditResourceReview, ResourceID: &review.ID}, before, review)
+
+	headers := make(http.Header)
+	headers.Set("ETag", reviewETag(review))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) moderateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, _ := app.readReview(w, r)
+	if review == nil {
+		return
+	}
+
+	if app.checkIfMatch(w, r, reviewETag(review)) {
+		return
+	}
+
+	before := *review
+
+	var input struct {
+		Status string `json:"status"`
+		Note   string `json:"note"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	now := time.Now()
+
+	review.Status = input.Status
+	review.ModerationNote = input.Note
+	review.ModeratedBy = &user.ID
+	review.ModeratedAt = &now
+
+	v := validator.New()
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "review.moderate", ResourceType: data.AuditResourceReview, ResourceID: &review.ID}, before, review)
+
+	headers := make(http.Header)
+	headers.Set("ETag", reviewETag(review))
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteReviewHandler removes a review. Authors can delete their own, and
+// moderators any.
+func (app *application) deleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	review, moderator := app.readReview(w, r)
+	if review == nil {
+		return
+	}
+
+	if review.UserID != app.contextGetUser(r).ID && !moderator {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.Reviews.Delete(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &data.AuditEvent{Action: "review.delete", ResourceType: data.AuditResourceReview, ResourceID: &review.ID}, review, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"awesomeProject3/internal/data"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 )
@@ -15,16 +16,134 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/scales", app.requirePermission("scales:read", app.listFoodScalesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/scales", app.requirePermission("scales:write", app.newFoodScalesHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/scales/:id", app.requirePermission("scales:read", app.showFoodScalesHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/scales/:id", app.requirePermission("scales:write", app.updateFoodScalesHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/scales/:serverID", app.requirePermission("scales:write", app.deleteFoodScalesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/scales", app.requirePermission("scales:write", app.idempotent(maxJSONBodyBytes, app.newFoodScalesHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.showFoodScalesHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/scales/:id", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleEditor, app.replaceFoodScalesHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/scales/:id", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleEditor, app.updateFoodScalesHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/scales/:id", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleOwner, app.deleteFoodScalesHandler)))
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/similar", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.listSimilarFoodScalesHandler)))
+
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/undelete", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleOwner, app.idempotent(maxJSONBodyBytes, app.undeleteFoodScalesHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/trash/scales", app.requirePermission("scales:admin", app.listDeletedFoodScalesHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/versions", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.listFoodScaleVersionsHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/versions/:version", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.showFoodScaleVersionHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/versions/:version/restore", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleEditor, app.idempotent(maxJSONBodyBytes, app.restoreFoodScaleVersionHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/diff", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.diffFoodScaleVersionsHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/reviews", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.listFoodScaleReviewsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/reviews", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.idempotent(maxJSONBodyBytes, app.createReviewHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/reviews/:reviewID", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.showReviewHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/scales/:id/reviews/:reviewID", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.updateReviewHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/scales/:id/reviews/:reviewID", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.deleteReviewHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/scales/:id/reviews/:reviewID/moderation", app.requirePermission("reviews:moderate", app.moderateReviewHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/reviews", app.requirePermission("reviews:moderate", app.listReviewsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/attachments", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.listAttachmentsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/attachments", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleEditor, app.idempotent(app.config.uploads.maxBytes+multipartOverhead, app.uploadAttachmentHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/attachments/:attachmentID", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.showAttachmentHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/scales/:id/attachments/:attachmentID", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleEditor, app.deleteAttachmentHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/attachments/:attachmentID/download", app.downloadAttachmentHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/attachments/:attachmentID/thumbnail", app.downloadAttachmentThumbnailHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/calibrations", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.listCalibrationsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/calibrations", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleEditor, app.idempotent(maxJSONBodyBytes, app.createCalibrationHandler))))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/calibrations/:calibrationID", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.showCalibrationHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/calibrations/:calibrationID/certificate", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.downloadCalibrationCertificateHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/calibrations/overdue", app.requirePermission("scales:read", app.listOverdueCalibrationsHandler))
+
+	router.HandlerFunc(http.MethodPut, "/v1/scales/:id/owner", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleOwner, app.transferFoodScaleOwnerHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/acl", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.listFoodScaleACLHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/acl", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleOwner, app.idempotent(maxJSONBodyBytes, app.grantFoodScaleACLHandler))))
+	router.HandlerFunc(http.MethodDelete, "/v1/scales/:id/acl/:entryID", app.requirePermission("scales:write", app.requireFoodScaleRole(data.RoleOwner, app.revokeFoodScaleACLHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/stock", app.requirePermission("inventory:read", app.requireFoodScaleRole(data.RoleViewer, app.showFoodScaleStockHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/scales/:id/stock/movements", app.requirePermission("inventory:read", app.requireFoodScaleRole(data.RoleViewer, app.listStockMovementsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/scales/:id/stock/movements", app.requirePermission("inventory:write", app.requireFoodScaleRole(data.RoleEditor, app.idempotent(maxJSONBodyBytes, app.createStockMovementHandler))))
+
+	router.HandlerFunc(http.MethodGet, "/v1/locations", app.requirePermission("inventory:read", app.listLocationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/locations", app.requirePermission("inventory:write", app.idempotent(maxJSONBodyBytes, app.createLocationHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/locations/:id", app.requirePermission("inventory:read", app.showLocationHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/locations/:id", app.requirePermission("inventory:write", app.updateLocationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/locations/:id/stock", app.requirePermission("inventory:read", app.showLocationStockHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/devices", app.requirePermission("scales:read", app.listDevicesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/devices", app.requirePermission("scales:write", app.createDeviceHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/devices/:id", app.requirePermission("scales:read", app.showDeviceHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/devices/:id", app.requirePermission("scales:read", app.updateDeviceHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/devices/:id", app.requirePermission("scales:read", app.deleteDeviceHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/devices/:id/credential", app.requirePermission("scales:read", app.rotateDeviceCredentialHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/devices/:id/readings", app.requirePermission("scales:read", app.listReadingsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/readings", app.requireDevice(app.idempotent(maxJSONBodyBytes, app.ingestReadingsHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/foods", app.requirePermission("foods:read", app.listFoodsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/foods", app.requirePermission("foods:write", app.idempotent(maxJSONBodyBytes, app.createFoodHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/foods/:id", app.requirePermission("foods:read", app.showFoodHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/foods/:id", app.requirePermission("foods:write", app.updateFoodHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/foods/:id", app.requirePermission("foods:write", app.deleteFoodHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/nutrition/calculate", app.requirePermission("foods:read", app.calculateNutritionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/manufacturers", app.requirePermission("scales:read", app.listManufacturersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/manufacturers", app.requirePermission("scales:write", app.idempotent(maxJSONBodyBytes, app.createManufacturerHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/manufacturers/:id", app.requirePermission("scales:read", app.showManufacturerHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/groups", app.requirePermission("scales:admin", app.idempotent(maxJSONBodyBytes, app.createGroupHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/groups/:id/members", app.requirePermission("scales:admin", app.idempotent(maxJSONBodyBytes, app.addGroupMemberHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/groups/:id/members/:userID", app.requirePermission("scales:admin", app.removeGroupMemberHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users", app.idempotent(maxJSONBodyBytes, app.registerUserHandler))
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
 
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/favorites", app.requirePermission("scales:read", app.listFavoritesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/favorites/:id", app.requirePermission("scales:read", app.addFavoriteHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/favorites/:id", app.requirePermission("scales:read", app.removeFavoriteHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlists", app.requirePermission("scales:read", app.listWatchlistsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlists", app.requirePermission("scales:read", app.idempotent(maxJSONBodyBytes, app.createWatchlistHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlists/:id", app.requirePermission("scales:read", app.showWatchlistHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlists/:id", app.requirePermission("scales:read", app.deleteWatchlistHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/watchlists/:id/items/:scaleID", app.requirePermission("scales:read", app.addWatchlistItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlists/:id/items/:scaleID", app.requirePermission("scales:read", app.removeWatchlistItemHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/watchlists/:id/share", app.requirePermission("scales:read", app.shareWatchlistHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlists/:id/share", app.requirePermission("scales:read", app.unshareWatchlistHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/price-alerts", app.requirePermission("scales:read", app.listPriceAlertsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/price-alerts/:id", app.requirePermission("scales:read", app.requireFoodScaleRole(data.RoleViewer, app.setPriceAlertHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/price-alerts/:id", app.requirePermission("scales:read", app.deletePriceAlertHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/price-alert-settings", app.requirePermission("scales:read", app.showPriceAlertSettingsHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/price-alert-settings", app.requirePermission("scales:read", app.updatePriceAlertSettingsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/price-alerts/unsubscribe", app.unsubscribePriceAlertsHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requirePermission("scales:read", app.exportFavoritesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/watchlists/shared/:token", app.showSharedWatchlistHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/invitations", app.requirePermission("users:admin", app.listInvitationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/invitations", app.requirePermission("users:admin", app.createInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/invitations/:id", app.requirePermission("users:admin", app.revokeInvitationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/invitations/accepted", app.acceptInvitationHandler)
+
+	// Like device registration, credential rotation, watchlist sharing and
+	// invitations, this route returns a secret and so is never wrapped by
+	// idempotent, which would store it.
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
-	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
+	router.HandlerFunc(http.MethodGet, "/v1/audit", app.requirePermission("audit:read", app.listAuditEventsHandler))
+
+	// httprouter does not allow a static path segment in the same position as
+	// a named parameter, so fixed paths like /v1/scales/by-sku/:sku live on a
+	// router of their own. It is consulted first and hands every request it
+	// has no route for over to the main router.
+	fixed := httprouter.New()
+	fixed.RedirectTrailingSlash = false
+	fixed.RedirectFixedPath = false
+	fixed.HandleMethodNotAllowed = false
+	fixed.HandleOPTIONS = false
+	fixed.NotFound = router
+
+	fixed.HandlerFunc(http.MethodPut, "/v1/scales/by-sku/:sku", app.requirePermission("scales:write", app.upsertFoodScalesBySKUHandler))
+	fixed.HandlerFunc(http.MethodGet, "/v1/scales/by-gtin/:code", app.requirePermission("scales:read", app.showFoodScaleByGTINHandler))
+	fixed.HandlerFunc(http.MethodGet, "/v1/scales/compare", app.requirePermission("scales:read", app.compareFoodScalesHandler))
+	fixed.HandlerFunc(http.MethodGet, "/v1/scales/stats", app.requirePermission("scales:read", app.showFoodScaleStatsHandler))
+	fixed.HandlerFunc(http.MethodPost, "/v1/scales/batch", app.requirePermission("scales:write", app.idempotent(maxJSONBodyBytes, app.batchFoodScalesHandler)))
+
+	return app.recoverPanic(app.requestID(app.enableCORS(app.rateLimit(app.authenticate(fixed)))))
 
 }
@@ -33,6 +33,8 @@ func (app *application) serve() error {
 			"signal": s.String(),
 		})
 
+		close(app.stopping)
+
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
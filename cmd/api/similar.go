@@ -0,0 +1,67 @@
+package main
+
+import (
+	"awesomeProject3/internal/data"
+	"awesomeProject3/internal/validator"
+	"errors"
+	"net/http"
+)
+
+// listSimilarFoodScalesHandler suggests alternatives to a scale. The weights
+// default to the server configuration and can be overridden per request.
+func (app *application) listSimilarFoodScalesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Weights data.SimilarityWeights
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	defaults := app.config.similar.weights
+	input.Weights.Price = app.readFloat(qs, "weight_price", defaults.Price, v)
+	input.Weights.Year = app.readFloat(qs, "weight_year", defaults.Year, v)
+	input.Weights.Runtime = app.readFloat(qs, "weight_runtime", defaults.Runtime, v)
+	input.Weights.Dimensions = app.readFloat(qs, "weight_dimensions", defaults.Dimensions, v)
+	input.Weights.Model = app.readFloat(qs, "weight_model", defaults.Model, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 10, v)
+
+	input.Filters.Sort = "-score"
+	input.Filters.SortSafelist = []string{"-score"}
+
+	data.ValidateSimilarityWeights(v, input.Weights)
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	visibleTo, err := app.foodScaleVisibleTo(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	similar, metadata, err := app.models.FoodScales.GetSimilar(id, input.Weights, visibleTo, input.Filters)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"similar": similar, "weights": input.Weights, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"image"
+	"image/color"
+)
+
+// thumbnailSize is the longest side of a generated thumbnail in pixels.
+const thumbnailSize = 256
+
+// thumbnail scales img down so that its longest side is at most size pixels,
+// keeping its aspect ratio. Each thumbnail pixel averages a grid of up to 4x4
+// samples from the area it covers, which is cheap even for large photos and
+// avoids most of the aliasing of nearest-neighbour scaling. Images that are
+// already small enough are copied as they are.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+
+	const samples = 4
+
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+(y+1)*h/th
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+(x+1)*w/tw
+
+			var r, g, bl, a, n uint64
+			for sy := 0; sy < samples; sy++ {
+				py := y0 + (y1-y0)*(2*sy+1)/(2*samples)
+				for sx := 0; sx < samples; sx++ {
+					px := x0 + (x1-x0)*(2*sx+1)/(2*samples)
+					cr, cg, cb, ca := img.At(px, py).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
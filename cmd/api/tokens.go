@@ -55,6 +55,11 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	app.audit(r, &data.AuditEvent{ActorID: &user.ID, Action: "token.create", ResourceType: data.AuditResourceToken, ResourceID: &user.ID}, nil, map[string]interface{}{
+		"scope":  token.Scope,
+		"expiry": token.Expiry,
+	})
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
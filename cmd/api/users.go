@@ -46,7 +46,9 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
+	app.audit(r, &data.AuditEvent{ActorID: &user.ID, Action: "user.create", ResourceType: data.AuditResourceUser, ResourceID: &user.ID}, nil, user)
+
+	err = app.models.Permissions.AddForUser(user.ID, "scales:read")
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -98,6 +100,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		}
 		return
 	}
+	before := *user
+
 	user.Activated = true
 	err = app.models.Users.Update(user)
 	if err != nil {
@@ -114,6 +118,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 		return
 	}
+
+	app.audit(r, &data.AuditEvent{ActorID: &user.ID, Action: "user.activate", ResourceType: data.AuditResourceUser, ResourceID: &user.ID}, before, user)
 	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
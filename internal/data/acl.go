@@ -0,0 +1,192 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var ErrUnknownACLSubject = errors.New("unknown acl subject")
+
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// RoleIncludes reports whether a user holding role have is allowed to do
+// everything role want allows. An empty role includes nothing.
+func RoleIncludes(have, want string) bool {
+	return have != "" && roleRanks[have] >= roleRanks[want]
+}
+
+type ACLEntry struct {
+	ID          int64  `json:"id"`
+	FoodScaleID int64  `json:"foodscale_id"`
+	UserID      *int64 `json:"user_id,omitempty"`
+	GroupID     *int64 `json:"group_id,omitempty"`
+	Role        string `json:"role"`
+}
+
+func ValidateACLEntry(v *validator.Validator, entry *ACLEntry) {
+	v.Check(entry.UserID != nil || entry.GroupID != nil, "user_id", "either user_id or group_id must be provided")
+	v.Check(entry.UserID == nil || entry.GroupID == nil, "group_id", "must not be provided together with user_id")
+	v.Check(validator.In(entry.Role, RoleEditor, RoleViewer), "role", "must be either editor or viewer")
+}
+
+// ACLModel clears cached statistics whenever an entry changes, since they
+// are computed over the scales a user can see.
+type ACLModel struct {
+	DB    *sql.DB
+	stats *statsCache
+}
+
+// RoleForUser returns the strongest role the user holds on the scale, taking
+// ownership, direct grants and grants made to the user's groups into account.
+// An empty string means the user holds no role at all.
+func (m ACLModel) RoleForUser(foodscaleID, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return roleForUser(ctx, m.DB, foodscaleID, userID)
+}
+
+// roleForUser runs the lookup behind RoleForUser through db, so it can also
+// be made inside a transaction. Trashed scales are included.
+func roleForUser(ctx context.Context, db queryer, foodscaleID, userID int64) (string, error) {
+	query := `
+ 		SELECT CASE
+ 			WHEN f.owner_user_id = $2 THEN 'owner'
+ 			WHEN EXISTS (
+ 				SELECT 1 FROM "groups_users" gu
+ 				WHERE gu.group_id = f.owner_group_id AND gu.user_id = $2) THEN 'owner'
+ 			WHEN EXISTS (
+ 				SELECT 1 FROM "foodscales_acl" a
+ 				LEFT JOIN "groups_users" gu ON gu.group_id = a.group_id
+ 				WHERE a.foodscale_id = f.id AND a.role = 'editor' AND (a.user_id = $2 OR gu.user_id = $2)) THEN 'editor'
+ 			WHEN EXISTS (
+ 				SELECT 1 FROM "foodscales_acl" a
+ 				LEFT JOIN "groups_users" gu ON gu.group_id = a.group_id
+ 				WHERE a.foodscale_id = f.id AND (a.user_id = $2 OR gu.user_id = $2)) THEN 'viewer'
+ 			ELSE ''
+ 		END
+ 		FROM "FoodScales" f
+ 		WHERE f.id = $1 `
+
+	var role string
+	err := db.QueryRowContext(ctx, query, foodscaleID, userID).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return role, nil
+}
+
+func (m ACLModel) GetAllForFoodScale(foodscaleID int64) ([]*ACLEntry, error) {
+	query := `
+ 		SELECT id, foodscale_id, user_id, group_id, role
+ 		FROM "foodscales_acl"
+ 		WHERE foodscale_id = $1
+ 		ORDER BY id `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, foodscaleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*ACLEntry{}
+	for rows.Next() {
+		var entry ACLEntry
+		err := rows.Scan(&entry.ID, &entry.FoodScaleID, &entry.UserID, &entry.GroupID, &entry.Role)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Grant adds an entry for the user or group, or changes the role of the
+// existing one.
+func (m ACLModel) Grant(entry *ACLEntry) error {
+	query := `
+ 		INSERT INTO "foodscales_acl" (foodscale_id, user_id, group_id, role)
+ 		VALUES ($1, $2, $3, $4)
+ 		ON CONFLICT (foodscale_id, user_id) WHERE user_id IS NOT NULL DO UPDATE SET role = EXCLUDED.role
+ 		RETURNING id `
+	if entry.GroupID != nil {
+		query = `
+ 		INSERT INTO "foodscales_acl" (foodscale_id, user_id, group_id, role)
+ 		VALUES ($1, $2, $3, $4)
+ 		ON CONFLICT (foodscale_id, group_id) WHERE group_id IS NOT NULL DO UPDATE SET role = EXCLUDED.role
+ 		RETURNING id `
+	}
+
+	args := []interface{}{entry.FoodScaleID, entry.UserID, entry.GroupID, entry.Role}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID)
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), `pq: insert or update on table "foodscales_acl" violates foreign key constraint`):
+			return ErrUnknownACLSubject
+		default:
+			return err
+		}
+	}
+
+	if m.stats != nil {
+		m.stats.invalidate()
+	}
+	return nil
+}
+
+func (m ACLModel) Revoke(foodscaleID, entryID int64) error {
+	query := `
+ 		DELETE FROM "foodscales_acl"
+ 		WHERE id = $1 AND foodscale_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, entryID, foodscaleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if m.stats != nil {
+		m.stats.invalidate()
+	}
+	return nil
+}
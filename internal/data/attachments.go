@@ -0,0 +1,258 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	AttachmentImage    = "image"
+	AttachmentDocument = "document"
+)
+
+// Attachment is a photo, manual or spec sheet uploaded for a scale. The file
+// itself lives in a blob store under BlobKey; images also have a thumbnail
+// under ThumbnailKey.
+type Attachment struct {
+	ID           int64     `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	FoodScaleID  int64     `json:"foodscale_id"`
+	UploadedBy   *int64    `json:"uploaded_by,omitempty"`
+	Kind         string    `json:"kind"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	SHA256       []byte    `json:"-"`
+	Width        *int      `json:"width,omitempty"`
+	Height       *int      `json:"height,omitempty"`
+	BlobKey      string    `json:"-"`
+	ThumbnailKey *string   `json:"-"`
+}
+
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+const attachmentColumns = `
+ 		id, created_at, foodscale_id, uploaded_by, kind, filename, content_type, size, sha256,
+ 		width, height, blob_key, thumbnail_key `
+
+func (a *Attachment) scanTargets() []interface{} {
+	return []interface{}{
+		&a.ID,
+		&a.CreatedAt,
+		&a.FoodScaleID,
+		&a.UploadedBy,
+		&a.Kind,
+		&a.Filename,
+		&a.ContentType,
+		&a.Size,
+		&a.SHA256,
+		&a.Width,
+		&a.Height,
+		&a.BlobKey,
+		&a.ThumbnailKey,
+	}
+}
+
+// Insert records an attachment whose blobs have already been stored. It
+// returns ErrRecordNotFound when the scale does not exist or is in the trash.
+func (m AttachmentModel) Insert(a *Attachment) error {
+	query := `
+ 		INSERT INTO "attachments" (foodscale_id, uploaded_by, kind, filename, content_type, size, sha256, width, height, blob_key, thumbnail_key)
+ 		SELECT id, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+ 		FROM "FoodScales"
+ 		WHERE id = $1 AND deleted_at IS NULL
+ 		RETURNING id, created_at `
+
+	args := []interface{}{
+		a.FoodScaleID,
+		a.UploadedBy,
+		a.Kind,
+		a.Filename,
+		a.ContentType,
+		a.Size,
+		a.SHA256,
+		a.Width,
+		a.Height,
+		a.BlobKey,
+		a.ThumbnailKey,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the attachment. When foodscaleID is not zero the attachment
+// must also belong to that scale.
+func (m AttachmentModel) Get(foodscaleID, id int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT ` + attachmentColumns + `
+ 		FROM "attachments"
+ 		WHERE id = $1 AND ($2 = 0 OR foodscale_id = $2) `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var a Attachment
+
+	err := m.DB.QueryRowContext(ctx, query, id, foodscaleID).Scan(a.scanTargets()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &a, nil
+}
+
+func (m AttachmentModel) GetAllForFoodScale(foodscaleID int64) ([]*Attachment, error) {
+	query := `
+ 		SELECT ` + attachmentColumns + `
+ 		FROM "attachments"
+ 		WHERE foodscale_id = $1
+ 		ORDER BY created_at, id `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, foodscaleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+
+	for rows.Next() {
+		var a Attachment
+		err := rows.Scan(a.scanTargets()...)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+func (m AttachmentModel) Delete(id int64) error {
+	query := `
+ 		DELETE FROM "attachments"
+ 		WHERE id = $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// BlobKeysForTrashedBefore returns the blob keys of attachments whose scale
+// was moved to the trash before the cutoff, so their blobs can be removed
+// once the scales are purged.
+func (m AttachmentModel) BlobKeysForTrashedBefore(cutoff time.Time) ([]string, error) {
+	query := `
+ 		SELECT a.blob_key, a.thumbnail_key
+ 		FROM "attachments" a
+ 		JOIN "FoodScales" fs ON fs.id = a.foodscale_id
+ 		WHERE fs.deleted_at < $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+
+	for rows.Next() {
+		var key string
+		var thumbnailKey *string
+
+		err := rows.Scan(&key, &thumbnailKey)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+		if thumbnailKey != nil {
+			keys = append(keys, *thumbnailKey)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// OrphanedBlobKeys returns the keys no attachment refers to any more.
+func (m AttachmentModel) OrphanedBlobKeys(keys []string) ([]string, error) {
+	query := `
+ 		SELECT k
+ 		FROM unnest($1::text[]) AS k
+ 		WHERE NOT EXISTS (SELECT 1 FROM "attachments" a WHERE a.blob_key = k OR a.thumbnail_key = k) `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orphaned := []string{}
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		orphaned = append(orphaned, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return orphaned, nil
+}
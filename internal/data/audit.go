@@ -0,0 +1,192 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+const (
+	AuditResourceFoodScale    = "foodscale"
+	AuditResourceUser         = "user"
+	AuditResourceToken        = "token"
+	AuditResourceACL          = "acl"
+	AuditResourceGroup        = "group"
+	AuditResourceInvitation   = "invitation"
+	AuditResourceManufacturer = "manufacturer"
+	AuditResourceWatchlist    = "watchlist"
+	AuditResourceReview       = "review"
+	AuditResourceAttachment   = "attachment"
+	AuditResourceLocation     = "location"
+	AuditResourceStock        = "stock"
+	AuditResourceCalibration  = "calibration"
+	AuditResourceDevice       = "device"
+	AuditResourceFood         = "food"
+)
+
+type AuditEvent struct {
+	ID           int64           `json:"id"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ActorID      *int64          `json:"actor_id,omitempty"`
+	Action       string          `json:"action"`
+	ResourceType string          `json:"resource_type"`
+	ResourceID   *int64          `json:"resource_id,omitempty"`
+	Before       json.RawMessage `json:"before,omitempty"`
+	After        json.RawMessage `json:"after,omitempty"`
+	Diff         json.RawMessage `json:"diff,omitempty"`
+	IP           string          `json:"ip"`
+	RequestID    string          `json:"request_id"`
+}
+
+type AuditQuery struct {
+	ActorID      int64
+	Action       string
+	ResourceType string
+	ResourceID   int64
+	From         *time.Time
+	To           *time.Time
+}
+
+// diffJSON compares two JSON objects key by key and returns the keys whose
+// values differ, each mapped to its before and after value. Either side may
+// be empty, as is the case for creations and deletions.
+func diffJSON(before, after json.RawMessage) (json.RawMessage, error) {
+	b := map[string]interface{}{}
+	a := map[string]interface{}{}
+
+	if len(before) > 0 {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil, err
+		}
+	}
+	if len(after) > 0 {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	type change struct {
+		Before interface{} `json:"before"`
+		After  interface{} `json:"after"`
+	}
+	diff := map[string]change{}
+
+	for key, value := range b {
+		if !reflect.DeepEqual(value, a[key]) {
+			diff[key] = change{Before: value, After: a[key]}
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; !ok {
+			diff[key] = change{After: value}
+		}
+	}
+
+	return json.Marshal(diff)
+}
+
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func (m AuditModel) Insert(event *AuditEvent) error {
+	diff, err := diffJSON(event.Before, event.After)
+	if err != nil {
+		return err
+	}
+	event.Diff = diff
+
+	query := `
+ 		INSERT INTO "audit_events" (actor_id, action, resource_type, resource_id, before, after, diff, ip, request_id)
+ 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ 		RETURNING id, created_at `
+
+	args := []interface{}{
+		event.ActorID,
+		event.Action,
+		event.ResourceType,
+		event.ResourceID,
+		nullJSON(event.Before),
+		nullJSON(event.After),
+		nullJSON(event.Diff),
+		event.IP,
+		event.RequestID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (m AuditModel) GetAll(q AuditQuery, filters Filters) ([]*AuditEvent, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), id, created_at, actor_id, action, resource_type, resource_id, before, after, diff, ip, request_id
+ 		FROM "audit_events"
+ 		WHERE (actor_id = $1 OR $1 = 0)
+ 		AND (action = $2 OR $2 = '')
+ 		AND (resource_type = $3 OR $3 = '')
+ 		AND (resource_id = $4 OR $4 = 0)
+ 		AND ($5::timestamptz IS NULL OR created_at >= $5)
+ 		AND ($6::timestamptz IS NULL OR created_at < $6)
+ 		ORDER BY %s %s, id ASC
+ 		LIMIT $7 OFFSET $8 `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{q.ActorID, q.Action, q.ResourceType, q.ResourceID, q.From, q.To, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+		var before, after, diff []byte
+		err := rows.Scan(
+			&totalRecords,
+			&event.ID,
+			&event.CreatedAt,
+			&event.ActorID,
+			&event.Action,
+			&event.ResourceType,
+			&event.ResourceID,
+			&before,
+			&after,
+			&diff,
+			&event.IP,
+			&event.RequestID,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		event.Before, event.After, event.Diff = before, after, diff
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return events, metadata, nil
+}
+
+// nullJSON prepares a JSON document for a jsonb parameter. pq would send a
+// []byte as bytea, so the document is passed as a string instead.
+func nullJSON(js json.RawMessage) interface{} {
+	if len(js) == 0 {
+		return nil
+	}
+	return string(js)
+}
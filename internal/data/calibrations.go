@@ -0,0 +1,446 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	MaxCalibrationTests       = 20
+	MaxCalibrationIntervalDay = 5 * 366
+)
+
+// CalibrationTest is one test weight placed on the scale. The deviation and
+// result are derived from the nominal and measured weights and the tolerance.
+type CalibrationTest struct {
+	NominalGrams   float64 `json:"nominal_grams"`
+	MeasuredGrams  float64 `json:"measured_grams"`
+	ToleranceGrams float64 `json:"tolerance_grams"`
+	DeviationGrams float64 `json:"deviation_grams"`
+	Passed         bool    `json:"passed"`
+}
+
+func (t *CalibrationTest) evaluate() {
+	t.DeviationGrams = math.Round((t.MeasuredGrams-t.NominalGrams)*1000) / 1000
+	t.Passed = math.Abs(t.DeviationGrams) <= t.ToleranceGrams
+}
+
+// Calibration records a calibration of a scale by a technician. It passed
+// when every test weight read within its tolerance. Records are kept as they
+// were taken; a new calibration adds a record rather than changing one.
+type Calibration struct {
+	ID           int64             `json:"id"`
+	CreatedAt    time.Time         `json:"created_at"`
+	FoodScaleID  int64             `json:"foodscale_id"`
+	CalibratedOn Date              `json:"calibrated_on"`
+	NextDueOn    Date              `json:"next_due_on"`
+	Technician   string            `json:"technician"`
+	Tests        []CalibrationTest `json:"tests"`
+	Passed       bool              `json:"passed"`
+	Notes        string            `json:"notes,omitempty"`
+	RecordedBy   *int64            `json:"recorded_by,omitempty"`
+	RemindedAt   *time.Time        `json:"reminded_at,omitempty"`
+}
+
+// CertificateNumber identifies the calibration on its certificate.
+func (c *Calibration) CertificateNumber() string {
+	return certificateNumber(c.ID)
+}
+
+func certificateNumber(id int64) string {
+	return fmt.Sprintf("CAL-%06d", id)
+}
+
+// Evaluate derives the deviations and results of the tests and the overall
+// result from the measurements.
+func (c *Calibration) Evaluate() {
+	c.Passed = len(c.Tests) > 0
+	for i := range c.Tests {
+		c.Tests[i].evaluate()
+		c.Passed = c.Passed && c.Tests[i].Passed
+	}
+}
+
+func ValidateCalibration(v *validator.Validator, c *Calibration) {
+	v.Check(c.Technician != "", "technician", "must be provided")
+	v.Check(len(c.Technician) <= 100, "technician", "must not be more than 100 bytes long")
+
+	v.Check(!c.CalibratedOn.IsZero(), "calibrated_on", "must be provided")
+	v.Check(c.CalibratedOn.Year() >= 2000, "calibrated_on", "must not be before 2000")
+	v.Check(!c.CalibratedOn.After(Today().Time), "calibrated_on", "must not be in the future")
+
+	v.Check(!c.NextDueOn.IsZero(), "next_due_on", "must be provided")
+	v.Check(c.NextDueOn.After(c.CalibratedOn.Time), "next_due_on", "must be after calibrated_on")
+	v.Check(!c.NextDueOn.After(c.CalibratedOn.AddDays(MaxCalibrationIntervalDay).Time), "next_due_on", "must not be more than five years after calibrated_on")
+
+	v.Check(len(c.Tests) > 0, "tests", "must contain at least one test weight")
+	v.Check(len(c.Tests) <= MaxCalibrationTests, "tests", fmt.Sprintf("must not contain more than %d test weights", MaxCalibrationTests))
+	for i, t := range c.Tests {
+		key := fmt.Sprintf("tests[%d]", i)
+		v.Check(t.NominalGrams > 0 && t.NominalGrams <= 1_000_000, key, "nominal_grams must be between 0 and 1000000")
+		v.Check(t.MeasuredGrams >= 0 && t.MeasuredGrams <= 2_000_000, key, "measured_grams must be between 0 and 2000000")
+		v.Check(t.ToleranceGrams >= 0 && t.ToleranceGrams <= t.NominalGrams, key, "tolerance_grams must be between 0 and nominal_grams")
+	}
+
+	v.Check(len(c.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
+
+// OverdueCalibration is a scale whose latest calibration is due or failed.
+type OverdueCalibration struct {
+	FoodScaleID     int64        `json:"foodscale_id"`
+	Model           string       `json:"model"`
+	DaysOverdue     int          `json:"days_overdue"`
+	LastCalibration *Calibration `json:"last_calibration"`
+}
+
+// CalibrationReminder is the data of a reminder email.
+type CalibrationReminder struct {
+	Name        string `json:"name"`
+	FoodScaleID int64  `json:"foodscale_id"`
+	Model       string `json:"model"`
+	NextDueOn   string `json:"next_due_on"`
+	Overdue     bool   `json:"overdue"`
+	Certificate string `json:"certificate"`
+}
+
+type CalibrationModel struct {
+	DB *sql.DB
+}
+
+const calibrationColumns = `
+ 		c.id, c.created_at, c.foodscale_id, c.calibrated_on, c.next_due_on, c.technician, c.tests, c.passed, c.notes,
+ 		c.recorded_by, c.reminded_at `
+
+// scan reads the calibrationColumns, along with any extra targets placed
+// before them, from row.
+func (c *Calibration) scan(row interface{ Scan(...interface{}) error }, extra ...interface{}) error {
+	var tests []byte
+
+	targets := append(extra,
+		&c.ID,
+		&c.CreatedAt,
+		&c.FoodScaleID,
+		&c.CalibratedOn.Time,
+		&c.NextDueOn.Time,
+		&c.Technician,
+		&tests,
+		&c.Passed,
+		&c.Notes,
+		&c.RecordedBy,
+		&c.RemindedAt,
+	)
+
+	err := row.Scan(targets...)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(tests, &c.Tests)
+	if err != nil {
+		return err
+	}
+
+	// Stored passes are kept as recorded; only the derived values of each
+	// test are filled in again.
+	for i := range c.Tests {
+		c.Tests[i].evaluate()
+	}
+	return nil
+}
+
+// Insert evaluates and stores the calibration. It returns ErrRecordNotFound
+// when the scale does not exist or is in the trash.
+func (m CalibrationModel) Insert(c *Calibration) error {
+	c.Evaluate()
+
+	tests, err := json.Marshal(c.Tests)
+	if err != nil {
+		return err
+	}
+
+	query := `
+ 		INSERT INTO "calibrations" (foodscale_id, calibrated_on, next_due_on, technician, tests, passed, notes, recorded_by)
+ 		SELECT id, $2::date, $3::date, $4, $5, $6, $7, $8
+ 		FROM "FoodScales"
+ 		WHERE id = $1 AND deleted_at IS NULL
+ 		RETURNING id, created_at `
+
+	args := []interface{}{
+		c.FoodScaleID,
+		c.CalibratedOn.String(),
+		c.NextDueOn.String(),
+		c.Technician,
+		string(tests),
+		c.Passed,
+		c.Notes,
+		c.RecordedBy,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&c.ID, &c.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m CalibrationModel) Get(foodscaleID, id int64) (*Calibration, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT ` + calibrationColumns + `
+ 		FROM "calibrations" c
+ 		WHERE c.id = $1 AND c.foodscale_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var c Calibration
+
+	err := c.scan(m.DB.QueryRowContext(ctx, query, id, foodscaleID))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// GetAllForFoodScale returns a page of the scale's calibrations, latest
+// first.
+func (m CalibrationModel) GetAllForFoodScale(foodscaleID int64, filters Filters) ([]*Calibration, Metadata, error) {
+	query := `
+ 		SELECT count(*) OVER(), ` + calibrationColumns + `
+ 		FROM "calibrations" c
+ 		WHERE c.foodscale_id = $1
+ 		ORDER BY c.calibrated_on DESC, c.id DESC
+ 		LIMIT $2 OFFSET $3 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, foodscaleID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	calibrations := []*Calibration{}
+
+	for rows.Next() {
+		var c Calibration
+		err := c.scan(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		calibrations = append(calibrations, &c)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return calibrations, metadata, nil
+}
+
+// latestCalibrations selects the model of every scale that is not in the
+// trash, followed by its most recent calibration.
+const latestCalibrations = `
+ 		SELECT DISTINCT ON (c.foodscale_id) fs.model, ` + calibrationColumns + `
+ 		FROM "calibrations" c
+ 		JOIN "FoodScales" fs ON fs.id = c.foodscale_id
+ 		WHERE fs.deleted_at IS NULL
+ 		ORDER BY c.foodscale_id, c.calibrated_on DESC, c.id DESC `
+
+// GetOverdue returns a page of the scales whose latest calibration falls due
+// on or before the cutoff date or failed, most overdue first. Days overdue are
+// negative for scales not due yet. Scales that were never calibrated are not
+// listed, and neither are scales the user visibleTo cannot see; a zero
+// visibleTo lists every scale.
+func (m CalibrationModel) GetOverdue(cutoff Date, visibleTo int64, filters Filters) ([]*OverdueCalibration, Metadata, error) {
+	query := `
+ 		SELECT count(*) OVER(), (current_date - l.next_due_on), l.*
+ 		FROM (` + latestCalibrations + `) l
+ 		WHERE (l.next_due_on <= $1::date OR NOT l.passed)
+ 		AND EXISTS (
+ 			SELECT 1 FROM "FoodScales" fs
+ 			WHERE fs.id = l.foodscale_id AND ` + foodScaleVisibleCondition("$4") + `)
+ 		ORDER BY l.next_due_on, l.foodscale_id
+ 		LIMIT $2 OFFSET $3 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, cutoff.String(), filters.limit(), filters.offset(), visibleTo)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	overdue := []*OverdueCalibration{}
+
+	for rows.Next() {
+		o := OverdueCalibration{LastCalibration: &Calibration{}}
+
+		err := o.LastCalibration.scan(rows, &totalRecords, &o.DaysOverdue, &o.Model)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		o.FoodScaleID = o.LastCalibration.FoodScaleID
+		overdue = append(overdue, &o)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return overdue, metadata, nil
+}
+
+// QueueReminders queues a reminder email for every scale whose latest
+// calibration falls due within the given number of days and has not been
+// reminded of yet. Each calibration is reminded of once, to the user owning
+// the scale or to every member of the owning group. It returns the number of
+// emails queued.
+func (m CalibrationModel) QueueReminders(template string, days int) (int, error) {
+	query := `
+ 		SELECT l.id
+ 		FROM (` + latestCalibrations + `) l
+ 		WHERE l.reminded_at IS NULL AND l.next_due_on <= current_date + $1::integer `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, days)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, id := range ids {
+		sent, err := m.queueReminder(id, template)
+		if err != nil {
+			return queued, err
+		}
+		queued += sent
+	}
+	return queued, nil
+}
+
+// queueReminder marks the calibration as reminded of and queues the emails in
+// a single transaction. A calibration already marked by another instance is
+// skipped.
+func (m CalibrationModel) queueReminder(id int64, template string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+ 		UPDATE "calibrations" c
+ 		SET reminded_at = NOW()
+ 		FROM "FoodScales" fs
+ 		WHERE c.id = $1 AND c.reminded_at IS NULL AND fs.id = c.foodscale_id
+ 		RETURNING c.foodscale_id, fs.model, c.next_due_on, c.next_due_on < current_date `
+
+	reminder := CalibrationReminder{Certificate: certificateNumber(id)}
+	var nextDue Date
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&reminder.FoodScaleID, &reminder.Model, &nextDue.Time, &reminder.Overdue)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+	reminder.NextDueOn = nextDue.String()
+
+	query = `
+ 		SELECT u.name, u.email
+ 		FROM "FoodScales" fs
+ 		JOIN "Users" u ON u.id = fs.owner_user_id
+ 			OR u.id IN (SELECT gu.user_id FROM "groups_users" gu WHERE gu.group_id = fs.owner_group_id)
+ 		WHERE fs.id = $1 AND u.activated
+ 		ORDER BY u.id `
+
+	rows, err := tx.QueryContext(ctx, query, reminder.FoodScaleID)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type recipient struct{ name, email string }
+	var recipients []recipient
+
+	for rows.Next() {
+		var r recipient
+		if err := rows.Scan(&r.name, &r.email); err != nil {
+			return 0, err
+		}
+		recipients = append(recipients, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+
+	for _, r := range recipients {
+		reminder.Name = r.name
+		err = enqueueMail(tx, r.email, template, reminder)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(recipients), nil
+}
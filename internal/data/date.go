@@ -0,0 +1,59 @@
+package data
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidDateFormat = errors.New("invalid date format")
+
+const dateLayout = "2006-01-02"
+
+// Date is a calendar day without a time of day. It is read and written as
+// "YYYY-MM-DD" in JSON and maps to the date column type.
+type Date struct {
+	time.Time
+}
+
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, ErrInvalidDateFormat
+	}
+	return Date{t}, nil
+}
+
+func (d Date) String() string {
+	return d.Format(dateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(d.String())), nil
+}
+
+func (d *Date) UnmarshalJSON(jsonValue []byte) error {
+	unquotedJSONValue, err := strconv.Unquote(string(jsonValue))
+	if err != nil {
+		return ErrInvalidDateFormat
+	}
+
+	parsed, err := ParseDate(unquotedJSONValue)
+	if err != nil {
+		return err
+	}
+
+	*d = parsed
+	return nil
+}
+
+// AddDays returns the date n days later, or earlier when n is negative.
+func (d Date) AddDays(n int) Date {
+	return Date{d.AddDate(0, 0, n)}
+}
+
+// Today returns the current date in UTC.
+func Today() Date {
+	now := time.Now().UTC()
+	return Date{time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)}
+}
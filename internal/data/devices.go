@@ -0,0 +1,308 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidDeviceCredential = errors.New("invalid device credential")
+)
+
+// Device is a connected scale that sends weight readings. It is a physical
+// unit of one of the scale models in the catalogue and belongs to the user who
+// registered it.
+type Device struct {
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      int64      `json:"user_id"`
+	FoodScaleID int64      `json:"foodscale_id"`
+	Name        string     `json:"name"`
+	LastSeenAt  *time.Time `json:"last_seen_at,omitempty"`
+	Version     int32      `json:"version"`
+}
+
+func ValidateDevice(v *validator.Validator, device *Device) {
+	v.Check(device.FoodScaleID > 0, "foodscale_id", "must be provided")
+	v.Check(device.Name != "", "name", "must be provided")
+	v.Check(len(device.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+// DeviceCredential is what a device authenticates with, sent as
+// "Authorization: Device <id>.<secret>". Only the hash of the secret is
+// stored, so the plaintext is shown once when it is issued.
+type DeviceCredential struct {
+	Plaintext string `json:"credential"`
+	Hash      []byte `json:"-"`
+}
+
+func generateDeviceSecret() (string, []byte, error) {
+	randomBytes := make([]byte, 20)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(secret))
+	return secret, hash[:], nil
+}
+
+// ParseDeviceCredential splits a credential into the device id and secret.
+func ParseDeviceCredential(credential string) (int64, string, error) {
+	id, secret, found := strings.Cut(credential, ".")
+	if !found || len(secret) != 32 {
+		return 0, "", ErrInvalidDeviceCredential
+	}
+
+	deviceID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || deviceID < 1 {
+		return 0, "", ErrInvalidDeviceCredential
+	}
+	return deviceID, secret, nil
+}
+
+type DeviceModel struct {
+	DB *sql.DB
+}
+
+const deviceColumns = `id, created_at, user_id, foodscale_id, name, last_seen_at, version`
+
+func (device *Device) scanTargets() []interface{} {
+	return []interface{}{
+		&device.ID,
+		&device.CreatedAt,
+		&device.UserID,
+		&device.FoodScaleID,
+		&device.Name,
+		&device.LastSeenAt,
+		&device.Version,
+	}
+}
+
+// Insert registers the device and returns its first credential. It returns
+// ErrRecordNotFound when the scale does not exist or is in the trash.
+func (m DeviceModel) Insert(device *Device) (*DeviceCredential, error) {
+	secret, hash, err := generateDeviceSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+ 		INSERT INTO "devices" (user_id, foodscale_id, name, secret_hash)
+ 		SELECT $1, id, $3, $4
+ 		FROM "FoodScales"
+ 		WHERE id = $2 AND deleted_at IS NULL
+ 		RETURNING id, created_at, version `
+
+	args := []interface{}{device.UserID, device.FoodScaleID, device.Name, hash}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&device.ID, &device.CreatedAt, &device.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &DeviceCredential{Plaintext: fmt.Sprintf("%d.%s", device.ID, secret), Hash: hash}, nil
+}
+
+// Get returns the device if it belongs to the user.
+func (m DeviceModel) Get(id, userID int64) (*Device, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT ` + deviceColumns + `
+ 		FROM "devices"
+ 		WHERE id = $1 AND user_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var device Device
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(device.scanTargets()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &device, nil
+}
+
+// GetForCredential returns the device the credential belongs to. Devices of
+// scales in the trash cannot authenticate.
+func (m DeviceModel) GetForCredential(credential string) (*Device, error) {
+	id, secret, err := ParseDeviceCredential(credential)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT d.id, d.created_at, d.user_id, d.foodscale_id, d.name, d.last_seen_at, d.version, d.secret_hash
+ 		FROM "devices" d
+ 		JOIN "FoodScales" fs ON fs.id = d.foodscale_id
+ 		WHERE d.id = $1 AND fs.deleted_at IS NULL `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var device Device
+	var storedHash []byte
+
+	err = m.DB.QueryRowContext(ctx, query, id).Scan(append(device.scanTargets(), &storedHash)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(hash[:], storedHash) != 1 {
+		return nil, ErrRecordNotFound
+	}
+	return &device, nil
+}
+
+func (m DeviceModel) GetAllForUser(userID int64, filters Filters) ([]*Device, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), `+deviceColumns+`
+ 		FROM "devices"
+ 		WHERE user_id = $1
+ 		ORDER BY %s %s, id ASC
+ 		LIMIT $2 OFFSET $3 `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	devices := []*Device{}
+
+	for rows.Next() {
+		var device Device
+		err := rows.Scan(append([]interface{}{&totalRecords}, device.scanTargets()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		devices = append(devices, &device)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return devices, metadata, nil
+}
+
+// Update renames the device if its version still matches.
+func (m DeviceModel) Update(device *Device) error {
+	query := `
+ 		UPDATE "devices"
+ 		SET name = $1, version = version + 1
+ 		WHERE id = $2 AND user_id = $3 AND version = $4
+ 		RETURNING version `
+
+	args := []interface{}{device.Name, device.ID, device.UserID, device.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&device.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateCredential replaces the device's secret, so the old credential stops
+// working at once, and returns the new one.
+func (m DeviceModel) RotateCredential(device *Device) (*DeviceCredential, error) {
+	secret, hash, err := generateDeviceSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+ 		UPDATE "devices"
+ 		SET secret_hash = $1, version = version + 1
+ 		WHERE id = $2 AND user_id = $3
+ 		RETURNING version `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, hash, device.ID, device.UserID).Scan(&device.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &DeviceCredential{Plaintext: fmt.Sprintf("%d.%s", device.ID, secret), Hash: hash}, nil
+}
+
+// Delete removes the device along with all of its readings.
+func (m DeviceModel) Delete(id, userID int64) error {
+	query := `
+ 		DELETE FROM "devices"
+ 		WHERE id = $1 AND user_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ListedFoodScale is a scale in a user's favorites or in a watchlist, along
+// with when it was added there.
+type ListedFoodScale struct {
+	AddedAt   time.Time   `json:"added_at"`
+	FoodScale *FoodScales `json:"foodscale"`
+}
+
+// ListedFoodScaleSortSafelist holds the sort values accepted for favorites
+// and watchlist items.
+var ListedFoodScaleSortSafelist = []string{"added_at", "model", "price", "-added_at", "-model", "-price"}
+
+// getListedFoodScales returns a page of the scales in table whose column
+// listColumn equals listID. Scales in the trash are left out, and come back
+// if they are undeleted; purging them removes the rows for good. So are
+// scales the user visibleTo can no longer see, until access is granted again;
+// a zero visibleTo lists every scale.
+func getListedFoodScales(db *sql.DB, table, listColumn string, listID, visibleTo int64, filters Filters) ([]*ListedFoodScale, Metadata, error) {
+	columns := foodScaleColumns(nil)
+
+	qualified := make([]string, len(columns))
+	for i, column := range columns {
+		qualified[i] = "fs." + column
+	}
+
+	sortColumn := "fs." + filters.sortColumn()
+	if filters.sortColumn() == "added_at" {
+		sortColumn = "l.added_at"
+	}
+
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), l.added_at, %s
+ 		FROM %s l
+ 		JOIN "FoodScales" fs ON fs.id = l.foodscale_id
+ 		WHERE l.%s = $1 AND fs.deleted_at IS NULL AND %s
+ 		ORDER BY %s %s, fs.id ASC
+ 		LIMIT $2 OFFSET $3 `, strings.Join(qualified, ", "), table, listColumn, foodScaleVisibleCondition("$4"), sortColumn, filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, query, listID, filters.limit(), filters.offset(), visibleTo)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	listed := []*ListedFoodScale{}
+
+	for rows.Next() {
+		item := ListedFoodScale{FoodScale: &FoodScales{}}
+		targets := append([]interface{}{&totalRecords, &item.AddedAt}, item.FoodScale.scanTargets(columns)...)
+
+		err := rows.Scan(targets...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		listed = append(listed, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return listed, metadata, nil
+}
+
+// addListedFoodScale adds the scale to a list and returns when it was added.
+// Adding a scale twice keeps the original time. It returns ErrRecordNotFound
+// when the scale does not exist or is in the trash.
+func addListedFoodScale(db *sql.DB, table, listColumn string, listID, foodscaleID int64) (time.Time, error) {
+	query := fmt.Sprintf(`
+ 		INSERT INTO %[1]s (%[2]s, foodscale_id)
+ 		SELECT $1, id FROM "FoodScales" WHERE id = $2 AND deleted_at IS NULL
+ 		ON CONFLICT (%[2]s, foodscale_id) DO UPDATE SET added_at = %[1]s.added_at
+ 		RETURNING added_at `, table, listColumn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var addedAt time.Time
+	err := db.QueryRowContext(ctx, query, listID, foodscaleID).Scan(&addedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return time.Time{}, ErrRecordNotFound
+		default:
+			return time.Time{}, err
+		}
+	}
+	return addedAt, nil
+}
+
+func removeListedFoodScale(db *sql.DB, table, listColumn string, listID, foodscaleID int64) error {
+	query := fmt.Sprintf(`
+ 		DELETE FROM %s
+ 		WHERE %s = $1 AND foodscale_id = $2 `, table, listColumn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, query, listID, foodscaleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+type FavoriteModel struct {
+	DB *sql.DB
+}
+
+func (m FavoriteModel) Add(userID, foodscaleID int64) (time.Time, error) {
+	return addListedFoodScale(m.DB, `"favorites"`, "user_id", userID, foodscaleID)
+}
+
+func (m FavoriteModel) Remove(userID, foodscaleID int64) error {
+	return removeListedFoodScale(m.DB, `"favorites"`, "user_id", userID, foodscaleID)
+}
+
+func (m FavoriteModel) GetAll(userID, visibleTo int64, filters Filters) ([]*ListedFoodScale, Metadata, error) {
+	return getListedFoodScales(m.DB, `"favorites"`, "user_id", userID, visibleTo, filters)
+}
@@ -0,0 +1,428 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+var (
+	ErrDuplicateFoodCode = errors.New("duplicate food code")
+)
+
+// MaxNutritionGrams is the largest weight a nutrition calculation accepts.
+const MaxNutritionGrams = 100000
+
+// Nutrient describes one of the nutrients stored for foods. UnitsPerGram
+// converts grams to the nutrient's unit, and is zero for energy.
+type Nutrient struct {
+	Key          string  `json:"key"`
+	Name         string  `json:"name"`
+	Unit         string  `json:"unit"`
+	UnitsPerGram float64 `json:"-"`
+}
+
+// Nutrients lists the nutrients a food can have, macronutrients first. Amounts
+// are per 100 g of the food.
+var Nutrients = []Nutrient{
+	{Key: "energy_kcal", Name: "Energy", Unit: "kcal"},
+	{Key: "fat", Name: "Fat", Unit: "g", UnitsPerGram: 1},
+	{Key: "saturated_fat", Name: "Saturated fat", Unit: "g", UnitsPerGram: 1},
+	{Key: "carbohydrates", Name: "Carbohydrates", Unit: "g", UnitsPerGram: 1},
+	{Key: "sugars", Name: "Sugars", Unit: "g", UnitsPerGram: 1},
+	{Key: "fiber", Name: "Fibre", Unit: "g", UnitsPerGram: 1},
+	{Key: "proteins", Name: "Protein", Unit: "g", UnitsPerGram: 1},
+	{Key: "salt", Name: "Salt", Unit: "g", UnitsPerGram: 1},
+	{Key: "sodium", Name: "Sodium", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "cholesterol", Name: "Cholesterol", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "calcium", Name: "Calcium", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "iron", Name: "Iron", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "magnesium", Name: "Magnesium", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "potassium", Name: "Potassium", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "zinc", Name: "Zinc", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "vitamin_a", Name: "Vitamin A", Unit: "µg", UnitsPerGram: 1e6},
+	{Key: "vitamin_b12", Name: "Vitamin B12", Unit: "µg", UnitsPerGram: 1e6},
+	{Key: "vitamin_c", Name: "Vitamin C", Unit: "mg", UnitsPerGram: 1e3},
+	{Key: "vitamin_d", Name: "Vitamin D", Unit: "µg", UnitsPerGram: 1e6},
+}
+
+var nutrientsByKey = func() map[string]Nutrient {
+	m := make(map[string]Nutrient, len(Nutrients))
+	for _, n := range Nutrients {
+		m[n.Key] = n
+	}
+	return m
+}()
+
+// LookupNutrient returns the nutrient with the given key.
+func LookupNutrient(key string) (Nutrient, bool) {
+	n, ok := nutrientsByKey[key]
+	return n, ok
+}
+
+// Valid reports whether amount is possible per 100 g of food: no more than
+// 100 g of any one nutrient, and no more energy than pure fat has.
+func (n Nutrient) Valid(amount float64) bool {
+	if math.IsNaN(amount) || amount < 0 {
+		return false
+	}
+	if n.UnitsPerGram == 0 {
+		return amount <= 1000
+	}
+	return amount/n.UnitsPerGram <= 100
+}
+
+// Food is an item of the nutrition database. Code is its barcode or other
+// identifier in the database it was imported from, and Nutrients maps nutrient
+// keys to amounts per 100 g. Nutrients that are not known are left out.
+type Food struct {
+	ID        int64              `json:"id"`
+	CreatedAt time.Time          `json:"created_at"`
+	Code      *string            `json:"code,omitempty"`
+	Name      string             `json:"name"`
+	Brand     string             `json:"brand,omitempty"`
+	Nutrients map[string]float64 `json:"nutrients"`
+	Version   int32              `json:"version"`
+}
+
+func ValidateFood(v *validator.Validator, food *Food) {
+	v.Check(food.Name != "", "name", "must be provided")
+	v.Check(len(food.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(food.Brand) <= 200, "brand", "must not be more than 200 bytes long")
+
+	if food.Code != nil {
+		v.Check(*food.Code != "", "code", "must not be empty")
+		v.Check(len(*food.Code) <= 64, "code", "must not be more than 64 bytes long")
+	}
+
+	keys := make([]string, 0, len(food.Nutrients))
+	for key := range food.Nutrients {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		n, ok := nutrientsByKey[key]
+		if !ok {
+			v.AddError("nutrients", fmt.Sprintf("%s is not a known nutrient", key))
+			continue
+		}
+		if !n.Valid(food.Nutrients[key]) {
+			v.AddError("nutrients", fmt.Sprintf("%s must be a possible amount per 100 g", key))
+		}
+	}
+}
+
+// NutrientAmount is the amount of a nutrient in a weighed portion of food.
+type NutrientAmount struct {
+	Nutrient
+	Amount  float64 `json:"amount"`
+	Per100g float64 `json:"per_100g"`
+}
+
+// Calculate scales the food's nutrients to a portion of the given weight, in
+// the order of Nutrients. Amounts are rounded to two decimals.
+func (food *Food) Calculate(grams float64) []NutrientAmount {
+	amounts := []NutrientAmount{}
+	for _, n := range Nutrients {
+		per100g, ok := food.Nutrients[n.Key]
+		if !ok {
+			continue
+		}
+		amounts = append(amounts, NutrientAmount{
+			Nutrient: n,
+			Amount:   math.Round(per100g*grams) / 100,
+			Per100g:  per100g,
+		})
+	}
+	return amounts
+}
+
+// FoodQuery selects foods whose name matches Name, which is searched the way
+// scale models are.
+type FoodQuery struct {
+	Name string
+}
+
+func ValidateFoodQuery(v *validator.Validator, q FoodQuery) {
+	v.Check(len(q.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+// foodSearchCondition matches the foods selected by a FoodQuery whose args
+// are bound to $1 and $2. Like the scale search, it matches word prefixes as
+// well as words within trigram distance of the search.
+const foodSearchCondition = `
+ 		($1 = '' OR to_tsvector('simple', name) @@ to_tsquery('simple', $2) OR $1 <% name) `
+
+const foodRelevance = `ts_rank(to_tsvector('simple', name), to_tsquery('simple', $2)) + word_similarity($1, name)`
+
+func (q FoodQuery) args() []interface{} {
+	return []interface{}{q.Name, prefixTSQuery(q.Name)}
+}
+
+type FoodModel struct {
+	DB *sql.DB
+}
+
+const foodColumns = `id, created_at, code, name, brand, nutrients, version`
+
+// scan reads the foodColumns, along with any extra targets placed before
+// them, from row.
+func (food *Food) scan(row interface{ Scan(...interface{}) error }, extra ...interface{}) error {
+	var nutrients []byte
+
+	targets := append(extra,
+		&food.ID,
+		&food.CreatedAt,
+		&food.Code,
+		&food.Name,
+		&food.Brand,
+		&nutrients,
+		&food.Version,
+	)
+
+	err := row.Scan(targets...)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(nutrients, &food.Nutrients)
+}
+
+func (food *Food) marshalNutrients() (string, error) {
+	if food.Nutrients == nil {
+		food.Nutrients = map[string]float64{}
+	}
+	js, err := json.Marshal(food.Nutrients)
+	return string(js), err
+}
+
+func (m FoodModel) Insert(food *Food) error {
+	nutrients, err := food.marshalNutrients()
+	if err != nil {
+		return err
+	}
+
+	query := `
+ 		INSERT INTO "foods" (code, name, brand, nutrients)
+ 		VALUES ($1, $2, $3, $4)
+ 		RETURNING id, created_at, version `
+
+	args := []interface{}{food.Code, food.Name, food.Brand, nutrients}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&food.ID, &food.CreatedAt, &food.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "foods_code_idx"`:
+			return ErrDuplicateFoodCode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m FoodModel) Get(id int64) (*Food, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT ` + foodColumns + `
+ 		FROM "foods"
+ 		WHERE id = $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var food Food
+
+	err := food.scan(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &food, nil
+}
+
+func (m FoodModel) Update(food *Food) error {
+	nutrients, err := food.marshalNutrients()
+	if err != nil {
+		return err
+	}
+
+	query := `
+ 		UPDATE "foods"
+ 		SET code = $1, name = $2, brand = $3, nutrients = $4, version = version + 1
+ 		WHERE id = $5 AND version = $6
+ 		RETURNING version `
+
+	args := []interface{}{food.Code, food.Name, food.Brand, nutrients, food.ID, food.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&food.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "foods_code_idx"`:
+			return ErrDuplicateFoodCode
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m FoodModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+ 		DELETE FROM "foods"
+ 		WHERE id = $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m FoodModel) GetAll(q FoodQuery, filters Filters) ([]*Food, Metadata, error) {
+	orderBy := filters.sortColumn() + " " + filters.sortDirection()
+	if filters.sortColumn() == "relevance" {
+		orderBy = foodRelevance + " DESC"
+	}
+
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), %s
+ 		FROM "foods"
+ 		WHERE %s
+ 		ORDER BY %s, id ASC
+ 		LIMIT $3 OFFSET $4 `, foodColumns, foodSearchCondition, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := append(q.args(), filters.limit(), filters.offset())
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	foods := []*Food{}
+
+	for rows.Next() {
+		var food Food
+		err := food.scan(rows, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		foods = append(foods, &food)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return foods, metadata, nil
+}
+
+// FoodImportResult counts what importing a batch of foods did.
+type FoodImportResult struct {
+	Inserted  int `json:"inserted"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+}
+
+// Import stores a batch of foods in one transaction, matching them to the
+// foods already stored by code, so importing a newer dump of the same database
+// updates foods in place. Every food must have a code. Foods whose name, brand
+// and nutrients are the same as stored are left alone, version included.
+func (m FoodModel) Import(foods []*Food) (*FoodImportResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `
+ 		INSERT INTO "foods" AS f (code, name, brand, nutrients)
+ 		VALUES ($1, $2, $3, $4)
+ 		ON CONFLICT (code) DO UPDATE
+ 		SET name = EXCLUDED.name, brand = EXCLUDED.brand, nutrients = EXCLUDED.nutrients, version = f.version + 1
+ 		WHERE (f.name, f.brand, f.nutrients) IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.brand, EXCLUDED.nutrients)
+ 		RETURNING id, created_at, version, xmax = 0 `)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	result := &FoodImportResult{}
+
+	for _, food := range foods {
+		if food.Code == nil {
+			return nil, fmt.Errorf("food %q has no code", food.Name)
+		}
+
+		nutrients, err := food.marshalNutrients()
+		if err != nil {
+			return nil, err
+		}
+
+		var inserted bool
+		err = stmt.QueryRowContext(ctx, *food.Code, food.Name, food.Brand, nutrients).Scan(&food.ID, &food.CreatedAt, &food.Version, &inserted)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			result.Unchanged++
+		case err != nil:
+			return nil, err
+		case inserted:
+			result.Inserted++
+		default:
+			result.Updated++
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,200 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FoodScaleQuery holds the search and filter criteria of the scales
+// catalogue. Zero values leave a criterion out. VisibleTo restricts the
+// scales to those the user holds a role on; it is set from the caller rather
+// than the query string, and left zero for administrators.
+type FoodScaleQuery struct {
+	Model          string
+	Year           int
+	MinPrice       float64
+	MaxPrice       float64
+	ManufacturerID int64
+	InStock        bool
+	LocationID     int64
+	VisibleTo      int64
+}
+
+func ValidateFoodScaleQuery(v *validator.Validator, q FoodScaleQuery) {
+	v.Check(len(q.Model) <= 100, "model", "must not be more than 100 bytes long")
+	v.Check(q.Year >= 0, "year", "must not be negative")
+	v.Check(q.MinPrice >= 0, "min_price", "must not be negative")
+	v.Check(q.MaxPrice >= 0, "max_price", "must not be negative")
+	v.Check(q.MaxPrice == 0 || q.MinPrice <= q.MaxPrice, "max_price", "must not be less than min_price")
+	v.Check(q.ManufacturerID >= 0, "manufacturer_id", "must not be negative")
+	v.Check(q.LocationID >= 0, "location_id", "must not be negative")
+	v.Check(q.LocationID == 0 || q.InStock, "location_id", "must be used with in_stock")
+}
+
+// foodScaleSearchCondition matches the scales selected by a FoodScaleQuery
+// whose args are bound to $1 to $9, with the "FoodScales" table aliased as fs.
+// A model search matches words starting with the search terms as well as words
+// within trigram distance of them, so that prefixes and small typos still find
+// the scale. The stock filter keeps scales with units on hand at any location,
+// or at the given one.
+var foodScaleSearchCondition = `
+ 		($1 = '' OR to_tsvector('simple', model) @@ to_tsquery('simple', $2) OR $1 <% model)
+ 		AND (year = $3 OR $3 = 0)
+ 		AND (price >= $4::float8 OR $4::float8 = 0)
+ 		AND (price <= $5::float8 OR $5::float8 = 0)
+ 		AND (manufacturer_id = $6 OR $6 = 0)
+ 		AND (NOT $7::boolean OR EXISTS (
+ 			SELECT 1 FROM "stock_levels" sl
+ 			WHERE sl.foodscale_id = fs.id AND sl.on_hand > 0 AND (sl.location_id = $8 OR $8 = 0)))
+ 		AND ` + foodScaleVisibleCondition("$9") + `
+ 		AND deleted_at IS NULL `
+
+// foodScaleVisibleCondition matches the scales, with the "FoodScales" table
+// aliased as fs, that the user whose ID is bound to param can see. It mirrors
+// ACLModel.RoleForUser: owners, members of the owning group and users granted
+// any role, directly or through a group, see the scale. A zero user ID, as
+// given for admins, matches every scale.
+func foodScaleVisibleCondition(param string) string {
+	return fmt.Sprintf(`(%[1]s::bigint = 0 OR fs.owner_user_id = %[1]s
+ 			OR EXISTS (
+ 				SELECT 1 FROM "groups_users" gu
+ 				WHERE gu.group_id = fs.owner_group_id AND gu.user_id = %[1]s)
+ 			OR EXISTS (
+ 				SELECT 1 FROM "foodscales_acl" a
+ 				LEFT JOIN "groups_users" gu ON gu.group_id = a.group_id
+ 				WHERE a.foodscale_id = fs.id AND (a.user_id = %[1]s OR gu.user_id = %[1]s)))`, param)
+}
+
+// foodScaleRelevance ranks a scale against the model search of a
+// FoodScaleQuery, combining full-text rank and trigram similarity.
+const foodScaleRelevance = `ts_rank(to_tsvector('simple', model), to_tsquery('simple', $2)) + word_similarity($1, model)`
+
+// foodScaleHighlight wraps the parts of the model matching the search in
+// <mark> tags.
+const foodScaleHighlight = `CASE WHEN $2 = '' THEN '' ELSE ts_headline('simple', model, to_tsquery('simple', $2), 'StartSel=<mark>, StopSel=</mark>, HighlightAll=true') END`
+
+func (q FoodScaleQuery) args() []interface{} {
+	return []interface{}{q.Model, prefixTSQuery(q.Model), q.Year, q.MinPrice, q.MaxPrice, q.ManufacturerID, q.InStock, q.LocationID, q.VisibleTo}
+}
+
+// prefixTSQuery turns free text into a tsquery matching words that start with
+// each of its terms, e.g. "kitchen sca" becomes "kitchen:* & sca:*".
+func prefixTSQuery(text string) string {
+	terms := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, term := range terms {
+		terms[i] = term + ":*"
+	}
+	return strings.Join(terms, " & ")
+}
+
+// PriceBuckets are the upper bounds of the price ranges scales are counted
+// in. The last range is open-ended.
+var PriceBuckets = []float64{25, 50, 100, 250, 500}
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int    `json:"count"`
+}
+
+type PriceFacetCount struct {
+	Min   float64  `json:"min"`
+	Max   *float64 `json:"max,omitempty"`
+	Count int      `json:"count"`
+}
+
+// Facets counts the scales matching a query by year, price range and
+// manufacturer, for rendering filter options next to the results.
+type Facets struct {
+	Year         []FacetCount      `json:"year"`
+	Price        []PriceFacetCount `json:"price"`
+	Manufacturer []FacetCount      `json:"manufacturer"`
+}
+
+func (m FoodScaleModel) GetFacets(q FoodScaleQuery) (*Facets, error) {
+	query := `
+ 		WITH matches AS (
+ 			SELECT year, price, manufacturer_id
+ 			FROM "FoodScales" fs
+ 			WHERE ` + foodScaleSearchCondition + `
+ 		)
+ 		SELECT 'year', year::text, '', count(*) FROM matches GROUP BY year
+ 		UNION ALL
+ 		SELECT 'price', width_bucket(price::float8, $10::float8[])::text, '', count(*) FROM matches GROUP BY 2
+ 		UNION ALL
+ 		SELECT 'manufacturer', mf.id::text, mf.name, count(*)
+ 		FROM matches JOIN "manufacturers" mf ON mf.id = matches.manufacturer_id
+ 		GROUP BY mf.id, mf.name `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := append(q.args(), pq.Array(PriceBuckets))
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := &Facets{
+		Year:         []FacetCount{},
+		Price:        []PriceFacetCount{},
+		Manufacturer: []FacetCount{},
+	}
+
+	for rows.Next() {
+		var facet string
+		var count FacetCount
+
+		err := rows.Scan(&facet, &count.Value, &count.Label, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch facet {
+		case "year":
+			facets.Year = append(facets.Year, count)
+		case "manufacturer":
+			facets.Manufacturer = append(facets.Manufacturer, count)
+		case "price":
+			bucket, err := strconv.Atoi(count.Value)
+			if err != nil {
+				return nil, err
+			}
+			price := PriceFacetCount{Count: count.Count}
+			if bucket > 0 {
+				price.Min = PriceBuckets[bucket-1]
+			}
+			if bucket < len(PriceBuckets) {
+				price.Max = &PriceBuckets[bucket]
+			}
+			facets.Price = append(facets.Price, price)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(facets.Year, func(i, j int) bool { return facets.Year[i].Value > facets.Year[j].Value })
+	sort.Slice(facets.Price, func(i, j int) bool { return facets.Price[i].Min < facets.Price[j].Min })
+	sort.Slice(facets.Manufacturer, func(i, j int) bool {
+		if facets.Manufacturer[i].Count != facets.Manufacturer[j].Count {
+			return facets.Manufacturer[i].Count > facets.Manufacturer[j].Count
+		}
+		return facets.Manufacturer[i].Label < facets.Manufacturer[j].Label
+	})
+
+	return facets, nil
+}
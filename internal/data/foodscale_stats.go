@@ -0,0 +1,228 @@
+package data
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StatsGroups maps the dimensions statistics can be grouped by to the columns
+// they group on and the label shown for each group.
+var StatsGroups = map[string]struct {
+	columns string
+	key     string
+	label   string
+	order   string
+	join    string
+}{
+	"year": {
+		columns: "fs.year",
+		key:     "fs.year::text",
+		label:   "''",
+		order:   "fs.year",
+	},
+	"manufacturer": {
+		columns: "fs.manufacturer_id, mf.name",
+		key:     "fs.manufacturer_id::text",
+		label:   "coalesce(mf.name, '')",
+		order:   "mf.name",
+		join:    `LEFT JOIN "manufacturers" mf ON mf.id = fs.manufacturer_id`,
+	},
+	"runtime": {
+		columns: "fs.runtime",
+		key:     "fs.runtime::text",
+		label:   "''",
+		order:   "fs.runtime",
+	},
+}
+
+// PriceStats summarises the prices of a set of scales. The price figures are
+// nil when the set is empty.
+type PriceStats struct {
+	Key         *string  `json:"key,omitempty"`
+	Label       string   `json:"label,omitempty"`
+	Count       int      `json:"count"`
+	MinPrice    *float64 `json:"min_price"`
+	MaxPrice    *float64 `json:"max_price"`
+	AvgPrice    *float64 `json:"avg_price"`
+	MedianPrice *float64 `json:"median_price"`
+}
+
+type FoodScaleStats struct {
+	GroupBy string        `json:"group_by,omitempty"`
+	Total   PriceStats    `json:"total"`
+	Groups  []*PriceStats `json:"groups,omitempty"`
+}
+
+// maxStatsCacheEntries bounds the number of queries statsCache keeps results
+// for. The least recently used entry makes room for a new one.
+const maxStatsCacheEntries = 1000
+
+// statsCache keeps computed statistics until the next write through the
+// FoodScaleModel or change to who can see which scales, or until they expire,
+// whichever comes first. The expiry bounds staleness when other instances
+// write to the same database.
+type statsCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	generation uint64
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+type statsCacheEntry struct {
+	key     string
+	stats   *FoodScaleStats
+	expires time.Time
+}
+
+func newStatsCache(ttl time.Duration) *statsCache {
+	return &statsCache{ttl: ttl, entries: make(map[string]*list.Element), lru: list.New()}
+}
+
+// get returns the cached statistics for key, if any, along with the current
+// generation to pass to put. An expired entry is dropped.
+func (c *statsCache) get(key string) (*FoodScaleStats, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, c.generation
+	}
+
+	entry := element.Value.(*statsCacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+		return nil, c.generation
+	}
+
+	c.lru.MoveToFront(element)
+	return entry.stats, c.generation
+}
+
+// put stores statistics computed during the given generation. They are
+// dropped if a write has invalidated the cache in the meantime.
+func (c *statsCache) put(key string, generation uint64, stats *FoodScaleStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	entry := &statsCacheEntry{key: key, stats: stats, expires: time.Now().Add(c.ttl)}
+
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > maxStatsCacheEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*statsCacheEntry).key)
+	}
+}
+
+func (c *statsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.entries = make(map[string]*list.Element)
+	c.lru.Init()
+}
+
+// invalidateStats drops cached statistics after a write.
+func (m FoodScaleModel) invalidateStats() {
+	if m.stats != nil {
+		m.stats.invalidate()
+	}
+}
+
+// GetStats returns price statistics for the scales matching the query, in
+// total and, when groupBy names one of the StatsGroups, per group.
+func (m FoodScaleModel) GetStats(q FoodScaleQuery, groupBy string) (*FoodScaleStats, error) {
+	cacheKey := fmt.Sprintf("%#v|%s", q, groupBy)
+
+	var generation uint64
+	if m.stats != nil && m.tx == nil {
+		var cached *FoodScaleStats
+		cached, generation = m.stats.get(cacheKey)
+		if cached != nil {
+			return cached, nil
+		}
+	}
+
+	// An aggregate without GROUP BY always returns a row, so there is a total
+	// even when no scale matches. When grouping, the empty grouping set plays
+	// the same part.
+	query := fmt.Sprintf(`
+ 		SELECT TRUE, NULL::text, '', count(*),
+ 			min(fs.price)::float8, max(fs.price)::float8, avg(fs.price)::float8,
+ 			percentile_cont(0.5) WITHIN GROUP (ORDER BY fs.price)
+ 		FROM "FoodScales" fs
+ 		WHERE %s `, foodScaleSearchCondition)
+
+	group, grouped := StatsGroups[groupBy]
+	if grouped {
+		query = fmt.Sprintf(`
+ 			SELECT GROUPING(%s) > 0 AS total, %s, %s, count(*),
+ 				min(fs.price)::float8, max(fs.price)::float8, avg(fs.price)::float8,
+ 				percentile_cont(0.5) WITHIN GROUP (ORDER BY fs.price)
+ 			FROM "FoodScales" fs %s
+ 			WHERE %s
+ 			GROUP BY GROUPING SETS ((), (%s))
+ 			ORDER BY total DESC, %s ASC `,
+			group.columns, group.key, group.label, group.join, foodScaleSearchCondition, group.columns, group.order)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, q.args()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &FoodScaleStats{}
+	if grouped {
+		stats.GroupBy = groupBy
+		stats.Groups = []*PriceStats{}
+	}
+
+	for rows.Next() {
+		var total bool
+		var ps PriceStats
+
+		err := rows.Scan(&total, &ps.Key, &ps.Label, &ps.Count, &ps.MinPrice, &ps.MaxPrice, &ps.AvgPrice, &ps.MedianPrice)
+		if err != nil {
+			return nil, err
+		}
+
+		if total {
+			ps.Key = nil
+			ps.Label = ""
+			stats.Total = ps
+			continue
+		}
+		stats.Groups = append(stats.Groups, &ps)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if m.stats != nil && m.tx == nil {
+		m.stats.put(cacheKey, generation, stats)
+	}
+	return stats, nil
+}
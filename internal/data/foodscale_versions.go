@@ -0,0 +1,211 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// FoodScaleVersion is a snapshot of a scale's content as it was at a given
+// version. Snapshots are written by a database trigger whenever a scale is
+// inserted or its version changes.
+type FoodScaleVersion struct {
+	FoodScaleID    int64     `json:"foodscale_id"`
+	Version        int32     `json:"version"`
+	CreatedAt      time.Time `json:"created_at"`
+	Model          string    `json:"model"`
+	Price          float32   `json:"price"`
+	Year           int32     `json:"year,omitempty"`
+	Dimensions     []float32 `json:"dimensions,omitempty"`
+	Runtime        Runtime   `json:"runtime,omitempty"`
+	SKU            *string   `json:"sku,omitempty"`
+	GTIN           *string   `json:"gtin,omitempty"`
+	ManufacturerID *int64    `json:"manufacturer_id,omitempty"`
+}
+
+// ApplyTo copies the snapshot's content onto the scale, leaving its identity,
+// ownership and current version untouched.
+func (fv *FoodScaleVersion) ApplyTo(foodscales *FoodScales) {
+	foodscales.Model = fv.Model
+	foodscales.Price = fv.Price
+	foodscales.Year = fv.Year
+	foodscales.Dimensions = fv.Dimensions
+	foodscales.Runtime = fv.Runtime
+	foodscales.SKU = fv.SKU
+	foodscales.GTIN = fv.GTIN
+	foodscales.ManufacturerID = fv.ManufacturerID
+}
+
+// Diff returns the content fields that differ from this snapshot to the other
+// one, each with its before and after value.
+func (fv *FoodScaleVersion) Diff(other *FoodScaleVersion) (json.RawMessage, error) {
+	before, err := json.Marshal(fv.content())
+	if err != nil {
+		return nil, err
+	}
+	after, err := json.Marshal(other.content())
+	if err != nil {
+		return nil, err
+	}
+	return diffJSON(before, after)
+}
+
+func (fv *FoodScaleVersion) content() interface{} {
+	return struct {
+		Model          string    `json:"model"`
+		Price          float32   `json:"price"`
+		Year           int32     `json:"year"`
+		Dimensions     []float32 `json:"dimensions"`
+		Runtime        Runtime   `json:"runtime"`
+		SKU            *string   `json:"sku"`
+		GTIN           *string   `json:"gtin"`
+		ManufacturerID *int64    `json:"manufacturer_id"`
+	}{fv.Model, fv.Price, fv.Year, fv.Dimensions, fv.Runtime, fv.SKU, fv.GTIN, fv.ManufacturerID}
+}
+
+type FoodScaleVersionModel struct {
+	DB *sql.DB
+}
+
+func (m FoodScaleVersionModel) Get(foodscaleID int64, version int32) (*FoodScaleVersion, error) {
+	if foodscaleID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT foodscale_id, version, created_at, model, year, runtime, dimensions, price, sku, gtin, manufacturer_id
+ 		FROM "foodscales_versions"
+ 		WHERE foodscale_id = $1 AND version = $2 `
+
+	var fv FoodScaleVersion
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, foodscaleID, version).Scan(
+		&fv.FoodScaleID,
+		&fv.Version,
+		&fv.CreatedAt,
+		&fv.Model,
+		&fv.Year,
+		&fv.Runtime,
+		pq.Array(&fv.Dimensions),
+		&fv.Price,
+		&fv.SKU,
+		&fv.GTIN,
+		&fv.ManufacturerID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &fv, nil
+}
+
+func (m FoodScaleVersionModel) GetAll(foodscaleID int64, filters Filters) ([]*FoodScaleVersion, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), foodscale_id, version, created_at, model, year, runtime, dimensions, price, sku, gtin, manufacturer_id
+ 		FROM "foodscales_versions"
+ 		WHERE foodscale_id = $1
+ 		ORDER BY %s %s
+ 		LIMIT $2 OFFSET $3 `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, foodscaleID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	versions := []*FoodScaleVersion{}
+
+	for rows.Next() {
+		var fv FoodScaleVersion
+		err := rows.Scan(
+			&totalRecords,
+			&fv.FoodScaleID,
+			&fv.Version,
+			&fv.CreatedAt,
+			&fv.Model,
+			&fv.Year,
+			&fv.Runtime,
+			pq.Array(&fv.Dimensions),
+			&fv.Price,
+			&fv.SKU,
+			&fv.GTIN,
+			&fv.ManufacturerID,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		versions = append(versions, &fv)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return versions, metadata, nil
+}
+
+// PriceChange is the current price of a scale together with the version and
+// time it was set at.
+type PriceChange struct {
+	Price   float32   `json:"price"`
+	Version int32     `json:"version"`
+	Since   time.Time `json:"since"`
+}
+
+// LatestPriceForIDs looks up when the current price of each of the scales was
+// set, keyed by scale id.
+func (m FoodScaleVersionModel) LatestPriceForIDs(foodscaleIDs []int64) (map[int64]*PriceChange, error) {
+	query := `
+ 		SELECT DISTINCT ON (foodscale_id) foodscale_id, price, version, created_at
+ 		FROM (
+ 			SELECT foodscale_id, price, version, created_at,
+ 				lag(price) OVER (PARTITION BY foodscale_id ORDER BY version) AS previous_price
+ 			FROM "foodscales_versions"
+ 			WHERE foodscale_id = ANY($1)
+ 		) AS history
+ 		WHERE previous_price IS DISTINCT FROM price
+ 		ORDER BY foodscale_id, version DESC `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(foodscaleIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	prices := make(map[int64]*PriceChange)
+
+	for rows.Next() {
+		var id int64
+		var pc PriceChange
+		err := rows.Scan(&id, &pc.Price, &pc.Version, &pc.Since)
+		if err != nil {
+			return nil, err
+		}
+		prices[id] = &pc
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
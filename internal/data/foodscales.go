@@ -7,17 +7,112 @@ import (
 	"errors"
 	"fmt"
 	"github.com/lib/pq"
+	"regexp"
+	"strings"
 	"time"
 )
 
+var (
+	ErrDuplicateSKU  = errors.New("duplicate sku")
+	ErrDuplicateGTIN = errors.New("duplicate gtin")
+)
+
+var SKURX = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
 type FoodScales struct {
-	Model      string    `json:"model" `
-	ID         int64     `json:"id"`
-	Price      float32   `json:"price"`
-	Year       int32     `json:"year,omitempty" `
-	Dimensions []float32 `json:"dimensions,omitempty" `
-	Runtime    Runtime   `json:"runtime,omitempty" `
-	Version    int32     `json:"version"`
+	Model          string     `json:"model" `
+	ID             int64      `json:"id"`
+	Price          float32    `json:"price"`
+	Year           int32      `json:"year,omitempty" `
+	Dimensions     []float32  `json:"dimensions,omitempty" `
+	Runtime        Runtime    `json:"runtime,omitempty" `
+	Version        int32      `json:"version"`
+	CreatedBy      *int64     `json:"created_by,omitempty"`
+	OwnerUserID    *int64     `json:"owner_user_id,omitempty"`
+	OwnerGroupID   *int64     `json:"owner_group_id,omitempty"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+	SKU            *string    `json:"sku,omitempty"`
+	GTIN           *string    `json:"gtin,omitempty"`
+	ManufacturerID *int64     `json:"manufacturer_id,omitempty"`
+	RatingAvg      *float64   `json:"rating_avg,omitempty"`
+	RatingCount    int32      `json:"rating_count"`
+	Highlight      string     `json:"highlight,omitempty"`
+}
+
+// FoodScaleFields lists the fields a client can select with a sparse
+// fieldset. Each one is named the same as its JSON key and its column.
+var FoodScaleFields = []string{
+	"id", "model", "price", "year", "dimensions", "runtime", "version",
+	"created_by", "owner_user_id", "owner_group_id", "sku", "gtin",
+	"manufacturer_id", "rating_avg", "rating_count",
+}
+
+func ValidateFoodScaleFields(v *validator.Validator, fields []string) {
+	for _, field := range fields {
+		v.Check(validator.In(field, FoodScaleFields...), "fields", fmt.Sprintf("unknown field %q", field))
+	}
+}
+
+// foodScaleColumns returns the columns to read for the given sparse fieldset,
+// or every field when it is empty. The id, version and rating aggregates are
+// always read because entity tags are derived from them.
+func foodScaleColumns(fields []string) []string {
+	if len(fields) == 0 {
+		return FoodScaleFields
+	}
+
+	always := []string{"id", "version", "rating_avg", "rating_count"}
+
+	columns := append([]string{}, always...)
+	for _, field := range fields {
+		if !validator.In(field, always...) {
+			columns = append(columns, field)
+		}
+	}
+	return columns
+}
+
+// scanTargets returns the destinations for reading the given columns into
+// the scale.
+func (fs *FoodScales) scanTargets(columns []string) []interface{} {
+	targets := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			targets[i] = &fs.ID
+		case "model":
+			targets[i] = &fs.Model
+		case "price":
+			targets[i] = &fs.Price
+		case "year":
+			targets[i] = &fs.Year
+		case "dimensions":
+			targets[i] = pq.Array(&fs.Dimensions)
+		case "runtime":
+			targets[i] = &fs.Runtime
+		case "version":
+			targets[i] = &fs.Version
+		case "created_by":
+			targets[i] = &fs.CreatedBy
+		case "owner_user_id":
+			targets[i] = &fs.OwnerUserID
+		case "owner_group_id":
+			targets[i] = &fs.OwnerGroupID
+		case "sku":
+			targets[i] = &fs.SKU
+		case "gtin":
+			targets[i] = &fs.GTIN
+		case "manufacturer_id":
+			targets[i] = &fs.ManufacturerID
+		case "rating_avg":
+			targets[i] = &fs.RatingAvg
+		case "rating_count":
+			targets[i] = &fs.RatingCount
+		default:
+			panic("unknown foodscale column: " + column)
+		}
+	}
+	return targets
 }
 
 func ValidateFoodScales(v *validator.Validator, foodscale *FoodScales) {
@@ -38,24 +133,125 @@ func ValidateFoodScales(v *validator.Validator, foodscale *FoodScales) {
 
 	v.Check(foodscale.Price != 0, "price", "must be provided")
 	v.Check(foodscale.Price <= 1000, "price", "must be cheaper than 1000")
+
+	if foodscale.SKU != nil {
+		ValidateSKU(v, *foodscale.SKU)
+	}
+
+	if foodscale.GTIN != nil {
+		ValidateGTIN(v, foodscale.GTIN)
+	}
+}
+
+func ValidateSKU(v *validator.Validator, sku string) {
+	v.Check(sku != "", "sku", "must not be empty")
+	v.Check(len(sku) <= 64, "sku", "must not be more than 64 bytes long")
+	v.Check(validator.Matches(sku, SKURX), "sku", "must only contain letters, digits, dots, dashes and underscores")
+}
+
+// ValidateGTIN checks the barcode and, when it is valid, rewrites it in place
+// to its GTIN-14 form, which is how GTINs are stored and compared.
+func ValidateGTIN(v *validator.Validator, gtin *string) {
+	normalized, ok := validator.NormalizeGTIN(*gtin)
+	if !ok {
+		v.AddError("gtin", "must be a valid UPC-A, EAN-13 or GTIN-14 code")
+		return
+	}
+	*gtin = normalized
 }
 
 type FoodScaleModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	tx    *sql.Tx
+	stats *statsCache
+}
+
+// queryer is the part of *sql.DB and *sql.Tx the model runs its statements
+// through.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (m FoodScaleModel) db() queryer {
+	if m.tx != nil {
+		return m.tx
+	}
+	return m.DB
+}
+
+// Transaction calls fn with a copy of the model whose statements all run in a
+// single transaction. The transaction is committed when fn returns nil and
+// rolled back otherwise.
+func (m FoodScaleModel) Transaction(fn func(FoodScaleModel) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txModel := m
+	txModel.tx = tx
+
+	err = fn(txModel)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	// Statistics read while the transaction was still open may have been
+	// cached before its writes became visible.
+	m.invalidateStats()
+	return nil
 }
 
 func (m FoodScaleModel) Insert(foodscale *FoodScales) error {
 	query := `
- 		INSERT INTO "FoodScales" (model, year, runtime, dimensions) 
-		VALUES ($1, $2, $3, $4)
+ 		INSERT INTO "FoodScales" (model, year, runtime, dimensions, price, created_by, owner_user_id, owner_group_id, sku, manufacturer_id, gtin) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
  		RETURNING id, price, version`
 
-	args := []interface{}{foodscale.Model, foodscale.Year, foodscale.Runtime, pq.Array(foodscale.Dimensions)}
+	args := []interface{}{
+		foodscale.Model,
+		foodscale.Year,
+		foodscale.Runtime,
+		pq.Array(foodscale.Dimensions),
+		foodscale.Price,
+		foodscale.CreatedBy,
+		foodscale.OwnerUserID,
+		foodscale.OwnerGroupID,
+		foodscale.SKU,
+		foodscale.ManufacturerID,
+		foodscale.GTIN,
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&foodscale.ID, &foodscale.Version, &foodscale.Price)
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&foodscale.ID, &foodscale.Price, &foodscale.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "foodscales_sku_idx"`:
+			return ErrDuplicateSKU
+		case err.Error() == `pq: duplicate key value violates unique constraint "foodscales_gtin_idx"`:
+			return ErrDuplicateGTIN
+		case isManufacturerViolation(err):
+			return ErrUnknownManufacturer
+		default:
+			return err
+		}
+	}
+
+	m.invalidateStats()
+	return nil
 
 }
 
@@ -64,10 +260,12 @@ func (m FoodScaleModel) Get(id int64) (*FoodScales, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
- 		SELECT id, model, year, runtime, dimensions, price, version
+	columns := foodScaleColumns(nil)
+
+	query := fmt.Sprintf(`
+ 		SELECT %s
  		FROM "FoodScales"
- 		WHERE id = $1 `
+ 		WHERE id = $1 AND deleted_at IS NULL `, strings.Join(columns, ", "))
 
 	var foodscales FoodScales
 
@@ -75,15 +273,7 @@ func (m FoodScaleModel) Get(id int64) (*FoodScales, error) {
 
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query).Scan(
-		&foodscales.ID,
-		&foodscales.Model,
-		&foodscales.Year,
-		&foodscales.Runtime,
-		pq.Array(&foodscales.Dimensions),
-		&foodscales.Price,
-		&foodscales.Version,
-	)
+	err := m.db().QueryRowContext(ctx, query, id).Scan(foodscales.scanTargets(columns)...)
 
 	if err != nil {
 		switch {
@@ -98,18 +288,62 @@ func (m FoodScaleModel) Get(id int64) (*FoodScales, error) {
 
 }
 
+// GetForIDs fetches the scales with the given ids in a single query. Ids that
+// do not exist or are in the trash are left out, so callers should compare
+// the result with what they asked for.
+func (m FoodScaleModel) GetForIDs(ids []int64) ([]*FoodScales, error) {
+	columns := foodScaleColumns(nil)
+
+	query := fmt.Sprintf(`
+ 		SELECT %s
+ 		FROM "FoodScales"
+ 		WHERE id = ANY($1) AND deleted_at IS NULL
+ 		ORDER BY id `, strings.Join(columns, ", "))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	foodscales := []*FoodScales{}
+
+	for rows.Next() {
+		var foodscale FoodScales
+		err := rows.Scan(foodscale.scanTargets(columns)...)
+		if err != nil {
+			return nil, err
+		}
+		foodscales = append(foodscales, &foodscale)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return foodscales, nil
+}
+
+// Update writes the scale if its version still matches. Price alerts on the
+// scale are evaluated against the new price in the same statement.
 func (m FoodScaleModel) Update(foodscales *FoodScales) error {
-	query := `
+	query := withPriceAlerts(`
  		UPDATE "FoodScales" 
- 		SET model = $1, year = $2, runtime = $3, dimensions = $4, version = version + 1
- 		WHERE id = $5 AND version = $6
- 		RETURNING version `
+ 		SET model = $1, year = $2, runtime = $3, dimensions = $4, price = $5, sku = $6, manufacturer_id = $7, gtin = $8, version = version + 1
+ 		WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+ 		RETURNING id, price, version `, "version")
 
 	args := []interface{}{
 		foodscales.Model,
 		foodscales.Year,
 		foodscales.Runtime,
 		pq.Array(foodscales.Dimensions),
+		foodscales.Price,
+		foodscales.SKU,
+		foodscales.ManufacturerID,
+		foodscales.GTIN,
 		foodscales.ID,
 		foodscales.Version,
 	}
@@ -117,32 +351,260 @@ func (m FoodScaleModel) Update(foodscales *FoodScales) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&foodscales.Version)
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&foodscales.Version)
 	if err != nil {
 		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "foodscales_sku_idx"`:
+			return ErrDuplicateSKU
+		case err.Error() == `pq: duplicate key value violates unique constraint "foodscales_gtin_idx"`:
+			return ErrDuplicateGTIN
+		case isManufacturerViolation(err):
+			return ErrUnknownManufacturer
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
 			return err
 		}
 	}
+
+	m.invalidateStats()
 	return nil
 
 }
 
+func (m FoodScaleModel) GetBySKU(sku string) (*FoodScales, error) {
+	query := `
+ 		SELECT id
+ 		FROM "FoodScales"
+ 		WHERE sku = $1 AND deleted_at IS NULL `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.db().QueryRowContext(ctx, query, sku).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.Get(id)
+}
+
+// RoleForUser is ACLModel.RoleForUser run through the model, so that inside
+// Transaction it sees the transaction's own writes.
+func (m FoodScaleModel) RoleForUser(foodscaleID, userID int64) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return roleForUser(ctx, m.db(), foodscaleID, userID)
+}
+
+// LockBySKU returns the scale with the SKU, trashed or not, and locks its row
+// until the transaction ends. It is meant to be called inside Transaction,
+// before a write that depends on what was read.
+func (m FoodScaleModel) LockBySKU(sku string) (*FoodScales, error) {
+	columns := foodScaleColumns(nil)
+
+	query := fmt.Sprintf(`
+ 		SELECT %s
+ 		FROM "FoodScales"
+ 		WHERE sku = $1
+ 		FOR UPDATE `, strings.Join(columns, ", "))
+
+	var foodscales FoodScales
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.db().QueryRowContext(ctx, query, sku).Scan(foodscales.scanTargets(columns)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &foodscales, nil
+}
+
+// GetByGTIN returns the scale with the barcode, which must already be in its
+// GTIN-14 form.
+func (m FoodScaleModel) GetByGTIN(gtin string) (*FoodScales, error) {
+	query := `
+ 		SELECT id
+ 		FROM "FoodScales"
+ 		WHERE gtin = $1 AND deleted_at IS NULL `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var id int64
+	err := m.db().QueryRowContext(ctx, query, gtin).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return m.Get(id)
+}
+
+// Upsert inserts the scale or, when a scale with the same SKU already exists,
+// replaces its content in the same statement. A trashed scale is brought back.
+// The version only moves when something actually changes, so repeating an
+// upsert is a no-op. Price alerts are evaluated as in Update. It reports
+// whether a new scale was created.
+func (m FoodScaleModel) Upsert(foodscale *FoodScales) (bool, error) {
+	query := withPriceAlerts(`
+ 		INSERT INTO "FoodScales" (model, year, runtime, dimensions, price, created_by, owner_user_id, owner_group_id, sku, manufacturer_id, gtin) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+ 		ON CONFLICT (sku) DO UPDATE
+ 		SET model = EXCLUDED.model, year = EXCLUDED.year, runtime = EXCLUDED.runtime, dimensions = EXCLUDED.dimensions,
+ 			price = EXCLUDED.price, manufacturer_id = EXCLUDED.manufacturer_id, gtin = EXCLUDED.gtin, deleted_at = NULL, version = "FoodScales".version + 1
+ 		WHERE "FoodScales".deleted_at IS NOT NULL
+ 			OR ("FoodScales".model, "FoodScales".year, "FoodScales".runtime, "FoodScales".dimensions, "FoodScales".price, "FoodScales".manufacturer_id, "FoodScales".gtin)
+ 			IS DISTINCT FROM (EXCLUDED.model, EXCLUDED.year, EXCLUDED.runtime, EXCLUDED.dimensions, EXCLUDED.price, EXCLUDED.manufacturer_id, EXCLUDED.gtin)
+ 		RETURNING id, price, version, xmax = 0 AS created `, "id, version, created")
+
+	args := []interface{}{
+		foodscale.Model,
+		foodscale.Year,
+		foodscale.Runtime,
+		pq.Array(foodscale.Dimensions),
+		foodscale.Price,
+		foodscale.CreatedBy,
+		foodscale.OwnerUserID,
+		foodscale.OwnerGroupID,
+		foodscale.SKU,
+		foodscale.ManufacturerID,
+		foodscale.GTIN,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var created bool
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&foodscale.ID, &foodscale.Version, &created)
+	if err != nil {
+		if isManufacturerViolation(err) {
+			return false, ErrUnknownManufacturer
+		}
+		if err.Error() == `pq: duplicate key value violates unique constraint "foodscales_gtin_idx"` {
+			return false, ErrDuplicateGTIN
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+
+		// Nothing changed, so the statement returned no row.
+		existing, err := m.GetBySKU(*foodscale.SKU)
+		if err != nil {
+			return false, err
+		}
+		*foodscale = *existing
+		return false, nil
+	}
+
+	m.invalidateStats()
+
+	stored, err := m.Get(foodscale.ID)
+	if err != nil {
+		return false, err
+	}
+	*foodscale = *stored
+	return created, nil
+}
+
+// SetOwner hands the scale over to a user or a group. Exactly one of userID
+// and groupID is expected to be non-nil.
+func (m FoodScaleModel) SetOwner(foodscales *FoodScales, userID, groupID *int64) error {
+	query := `
+ 		UPDATE "FoodScales" 
+ 		SET owner_user_id = $1, owner_group_id = $2, version = version + 1
+ 		WHERE id = $3 AND version = $4 AND deleted_at IS NULL
+ 		RETURNING version `
+
+	args := []interface{}{userID, groupID, foodscales.ID, foodscales.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.db().QueryRowContext(ctx, query, args...).Scan(&foodscales.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case strings.HasPrefix(err.Error(), `pq: insert or update on table "FoodScales" violates foreign key constraint`):
+			return ErrUnknownACLSubject
+		default:
+			return err
+		}
+	}
+	foodscales.OwnerUserID = userID
+	foodscales.OwnerGroupID = groupID
+
+	// Statistics are filtered on what the user can see.
+	m.invalidateStats()
+	return nil
+}
+
+// Delete moves the scale to the trash. It stays there, hidden from Get and
+// GetAll, until it is undeleted or purged.
 func (m FoodScaleModel) Delete(ID int64) error {
 	if ID < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-		DELETE FROM "FoodScales"
- 		WHERE id = $1 `
+		UPDATE "FoodScales"
+ 		SET deleted_at = NOW()
+ 		WHERE id = $1 AND deleted_at IS NULL `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	m.invalidateStats()
+	return nil
+}
+
+func (m FoodScaleModel) Undelete(ID int64) error {
+	if ID < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE "FoodScales"
+ 		SET deleted_at = NULL
+ 		WHERE id = $1 AND deleted_at IS NOT NULL `
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	result, err := m.DB.ExecContext(ctx, query, ID)
+	result, err := m.db().ExecContext(ctx, query, ID)
 	if err != nil {
 		return err
 	}
@@ -156,23 +618,41 @@ func (m FoodScaleModel) Delete(ID int64) error {
 		return ErrRecordNotFound
 	}
 
+	m.invalidateStats()
 	return nil
 }
 
-func (m FoodScaleModel) GetAll(model string, filters Filters) ([]*FoodScales, Metadata, error) {
+// PurgeDeleted permanently removes scales that were moved to the trash
+// before the cutoff and returns how many were removed.
+func (m FoodScaleModel) PurgeDeleted(cutoff time.Time) (int64, error) {
+	query := `
+		DELETE FROM "FoodScales"
+ 		WHERE deleted_at IS NOT NULL AND deleted_at < $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.db().ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	m.invalidateStats()
+	return result.RowsAffected()
+}
+
+func (m FoodScaleModel) GetDeleted(filters Filters) ([]*FoodScales, Metadata, error) {
 	query := fmt.Sprintf(`
- 		SELECT count(*) OVER(), id, version, model, year, runtime, dimensions, price
+ 		SELECT count(*) OVER(), id, model, year, runtime, dimensions, price, version, created_by, owner_user_id, owner_group_id, deleted_at, sku, gtin, manufacturer_id
  		FROM "FoodScales"
- 		WHERE (to_tsvector('simple', model) @@ plainto_tsquery('simple', $1) OR $1 = '') 
+ 		WHERE deleted_at IS NOT NULL
  		ORDER BY %s %s, id ASC
- 		LIMIT $3 OFFSET $4 `, filters.sortColumn(), filters.sortDirection())
+ 		LIMIT $1 OFFSET $2 `, filters.sortColumn(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{model, filters.limit(), filters.offset()}
-
-	rows, err := m.DB.QueryContext(ctx, query, args)
+	rows, err := m.db().QueryContext(ctx, query, filters.limit(), filters.offset())
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -192,6 +672,14 @@ func (m FoodScaleModel) GetAll(model string, filters Filters) ([]*FoodScales, Me
 			&foodscale.Runtime,
 			pq.Array(&foodscale.Dimensions),
 			&foodscale.Price,
+			&foodscale.Version,
+			&foodscale.CreatedBy,
+			&foodscale.OwnerUserID,
+			&foodscale.OwnerGroupID,
+			&foodscale.DeletedAt,
+			&foodscale.SKU,
+			&foodscale.GTIN,
+			&foodscale.ManufacturerID,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -208,3 +696,65 @@ func (m FoodScaleModel) GetAll(model string, filters Filters) ([]*FoodScales, Me
 
 	return foodscales, metadata, nil
 }
+
+// GetAll returns a page of the scales matching the query, each with the
+// matching parts of its model highlighted. Only the columns for the given
+// sparse fieldset are read; an empty fieldset reads them all. Sorting by
+// "relevance" puts the best matches for the model search first.
+func (m FoodScaleModel) GetAll(q FoodScaleQuery, fields []string, filters Filters) ([]*FoodScales, Metadata, error) {
+	columns := foodScaleColumns(fields)
+
+	orderBy := filters.sortColumn() + " " + filters.sortDirection()
+	switch filters.sortColumn() {
+	case "relevance":
+		orderBy = foodScaleRelevance + " DESC"
+	case "rating_avg":
+		// Unrated scales come last in either direction.
+		orderBy += " NULLS LAST"
+	}
+
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), %s, %s
+ 		FROM "FoodScales" fs
+ 		WHERE %s
+ 		ORDER BY %s, id ASC
+ 		LIMIT $10 OFFSET $11 `, strings.Join(columns, ", "), foodScaleHighlight, foodScaleSearchCondition, orderBy)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := append(q.args(), filters.limit(), filters.offset())
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	foodscales := []*FoodScales{}
+
+	for rows.Next() {
+		var foodscale FoodScales
+		targets := append([]interface{}{&totalRecords}, foodscale.scanTargets(columns)...)
+		err := rows.Scan(append(targets, &foodscale.Highlight)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		foodscales = append(foodscales, &foodscale)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return foodscales, metadata, nil
+}
+
+func isManufacturerViolation(err error) bool {
+	return strings.HasPrefix(err.Error(), `pq: insert or update on table "FoodScales" violates foreign key constraint "FoodScales_manufacturer_id_fkey"`)
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrDuplicateGroupName = errors.New("duplicate group name")
+)
+
+type Group struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+}
+
+func ValidateGroup(v *validator.Validator, group *Group) {
+	v.Check(group.Name != "", "name", "must be provided")
+	v.Check(len(group.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+// GroupModel clears cached statistics whenever membership changes, since
+// members see the scales their groups own or were granted.
+type GroupModel struct {
+	DB    *sql.DB
+	stats *statsCache
+}
+
+func (m GroupModel) Insert(group *Group) error {
+	query := `
+ 		INSERT INTO "groups" (name)
+ 		VALUES ($1)
+ 		RETURNING id, created_at `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, group.Name).Scan(&group.ID, &group.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "groups_name_key"`:
+			return ErrDuplicateGroupName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m GroupModel) AddUser(groupID, userID int64) error {
+	query := `
+ 		INSERT INTO "groups_users" (group_id, user_id)
+ 		VALUES ($1, $2)
+ 		ON CONFLICT DO NOTHING `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		switch {
+		case strings.HasPrefix(err.Error(), `pq: insert or update on table "groups_users" violates foreign key constraint`):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if m.stats != nil {
+		m.stats.invalidate()
+	}
+	return nil
+}
+
+func (m GroupModel) RemoveUser(groupID, userID int64) error {
+	query := `
+ 		DELETE FROM "groups_users"
+ 		WHERE group_id = $1 AND user_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if m.stats != nil {
+		m.stats.invalidate()
+	}
+	return nil
+}
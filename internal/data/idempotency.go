@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// IdempotentRequest is the stored outcome of a request sent with an
+// Idempotency-Key header. Until Completed is set the original request is
+// still being processed. Keys are scoped to the user or, for requests made
+// by a connected scale, to the device.
+type IdempotentRequest struct {
+	UserID      int64
+	DeviceID    int64
+	Key         string
+	RequestHash []byte
+	ExpiresAt   time.Time
+	Completed   bool
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+type IdempotencyModel struct {
+	DB *sql.DB
+}
+
+// Reserve claims the key for a new request. When the key is already held by
+// an unexpired request, Reserve returns false along with the stored record so
+// the caller can replay or reject it.
+func (m IdempotencyModel) Reserve(req *IdempotentRequest) (bool, *IdempotentRequest, error) {
+	query := `
+ 		INSERT INTO "idempotency_keys" (user_id, device_id, key, request_hash, expires_at)
+ 		VALUES ($1, $2, $3, $4, $5)
+ 		ON CONFLICT (user_id, device_id, key) DO UPDATE
+ 		SET request_hash = EXCLUDED.request_hash, expires_at = EXCLUDED.expires_at, created_at = NOW(),
+ 			completed = FALSE, status = 0, headers = NULL, body = NULL
+ 		WHERE "idempotency_keys".expires_at <= NOW()
+ 		RETURNING TRUE `
+
+	args := []interface{}{req.UserID, req.DeviceID, req.Key, req.RequestHash, req.ExpiresAt}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reserved bool
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&reserved)
+	if err == nil {
+		return true, nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, nil, err
+	}
+
+	existing, err := m.get(req.UserID, req.DeviceID, req.Key)
+	if err != nil {
+		return false, nil, err
+	}
+	return false, existing, nil
+}
+
+func (m IdempotencyModel) get(userID, deviceID int64, key string) (*IdempotentRequest, error) {
+	query := `
+ 		SELECT user_id, device_id, key, request_hash, expires_at, completed, status, headers, body
+ 		FROM "idempotency_keys"
+ 		WHERE user_id = $1 AND device_id = $2 AND key = $3 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var req IdempotentRequest
+	var headers []byte
+
+	err := m.DB.QueryRowContext(ctx, query, userID, deviceID, key).Scan(
+		&req.UserID,
+		&req.DeviceID,
+		&req.Key,
+		&req.RequestHash,
+		&req.ExpiresAt,
+		&req.Completed,
+		&req.Status,
+		&headers,
+		&req.Body,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	if len(headers) > 0 {
+		err = json.Unmarshal(headers, &req.Header)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &req, nil
+}
+
+// Complete stores the response so that retries with the same key can be
+// answered without running the request again.
+func (m IdempotencyModel) Complete(req *IdempotentRequest) error {
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+ 		UPDATE "idempotency_keys"
+ 		SET completed = TRUE, status = $1, headers = $2, body = $3
+ 		WHERE user_id = $4 AND device_id = $5 AND key = $6 `
+
+	args := []interface{}{req.Status, string(headers), req.Body, req.UserID, req.DeviceID, req.Key}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Release drops a reservation whose request failed in a way that should not
+// be replayed, so the client can retry with the same key.
+func (m IdempotencyModel) Release(userID, deviceID int64, key string) error {
+	query := `
+ 		DELETE FROM "idempotency_keys"
+ 		WHERE user_id = $1 AND device_id = $2 AND key = $3 AND completed = FALSE `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, deviceID, key)
+	return err
+}
+
+func (m IdempotencyModel) DeleteExpired() (int64, error) {
+	query := `
+ 		DELETE FROM "idempotency_keys"
+ 		WHERE expires_at <= NOW() `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,331 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	StockReceipt     = "receipt"
+	StockSale        = "sale"
+	StockAdjustment  = "adjustment"
+	StockTransferOut = "transfer_out"
+	StockTransferIn  = "transfer_in"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+var StockMovementSortSafelist = []string{"created_at", "-created_at"}
+
+// StockMovement is an entry in the stock ledger. Quantity is the change to the
+// quantity on hand: positive for receipts and incoming transfers, negative
+// for sales and outgoing transfers, either for adjustments. The two halves of
+// a transfer share a TransferID.
+type StockMovement struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	FoodScaleID int64     `json:"foodscale_id"`
+	LocationID  int64     `json:"location_id"`
+	Kind        string    `json:"kind"`
+	Quantity    int       `json:"quantity"`
+	TransferID  *int64    `json:"transfer_id,omitempty"`
+	Reference   string    `json:"reference,omitempty"`
+	Note        string    `json:"note,omitempty"`
+	CreatedBy   *int64    `json:"created_by,omitempty"`
+}
+
+func ValidateStockMovement(v *validator.Validator, movement *StockMovement) {
+	v.Check(movement.LocationID > 0, "location_id", "must be provided")
+	v.Check(movement.Quantity != 0, "quantity", "must not be zero")
+	v.Check(movement.Quantity >= -1_000_000 && movement.Quantity <= 1_000_000, "quantity", "must not be more than a million")
+	v.Check(len(movement.Reference) <= 100, "reference", "must not be more than 100 bytes long")
+	v.Check(len(movement.Note) <= 500, "note", "must not be more than 500 bytes long")
+
+	switch movement.Kind {
+	case StockReceipt, StockTransferIn:
+		v.Check(movement.Quantity > 0, "quantity", "must be positive")
+	case StockSale, StockTransferOut:
+		v.Check(movement.Quantity < 0, "quantity", "must be negative")
+	case StockAdjustment:
+		v.Check(movement.Note != "", "note", "must explain the adjustment")
+	default:
+		v.AddError("kind", "must be receipt, sale, adjustment or transfer")
+	}
+}
+
+// StockLevel is the quantity of a scale on hand at a location.
+type StockLevel struct {
+	FoodScaleID  int64     `json:"foodscale_id"`
+	Model        string    `json:"model,omitempty"`
+	LocationID   int64     `json:"location_id"`
+	LocationCode string    `json:"location_code,omitempty"`
+	OnHand       int       `json:"on_hand"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// InventoryModel keeps the stock ledger. The ledger is append-only; the
+// quantity on hand per scale and location is the sum of its movements, kept as
+// a running total in "stock_levels" that is only ever changed together with
+// the movements in the same transaction.
+type InventoryModel struct {
+	DB    *sql.DB
+	stats *statsCache
+}
+
+// Record adds the movements to the ledger in a single transaction. If any of
+// them would take the quantity on hand at its location below zero, none is
+// recorded and ErrInsufficientStock is returned. It returns ErrRecordNotFound
+// when the scale does not exist or is in the trash, and ErrUnknownLocation
+// when a location does not exist.
+func (m InventoryModel) Record(movements ...*StockMovement) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, movement := range movements {
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM "FoodScales" WHERE id = $1 AND deleted_at IS NULL`, movement.FoodScaleID).Scan(&id)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+	}
+
+	// Stock levels are locked in a fixed order so that two transfers in
+	// opposite directions cannot deadlock.
+	ordered := append([]*StockMovement{}, movements...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if ordered[i].FoodScaleID != ordered[j].FoodScaleID {
+			return ordered[i].FoodScaleID < ordered[j].FoodScaleID
+		}
+		return ordered[i].LocationID < ordered[j].LocationID
+	})
+
+	for _, movement := range ordered {
+		query := `
+ 			INSERT INTO "stock_levels" (foodscale_id, location_id)
+ 			VALUES ($1, $2)
+ 			ON CONFLICT (foodscale_id, location_id) DO NOTHING `
+
+		_, err := tx.ExecContext(ctx, query, movement.FoodScaleID, movement.LocationID)
+		if err != nil {
+			switch {
+			case isLocationViolation(err):
+				return ErrUnknownLocation
+			default:
+				return err
+			}
+		}
+
+		query = `
+ 			UPDATE "stock_levels"
+ 			SET on_hand = on_hand + $3, updated_at = NOW()
+ 			WHERE foodscale_id = $1 AND location_id = $2 AND on_hand + $3 >= 0
+ 			RETURNING on_hand `
+
+		var onHand int
+		err = tx.QueryRowContext(ctx, query, movement.FoodScaleID, movement.LocationID, movement.Quantity).Scan(&onHand)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrInsufficientStock
+			default:
+				return err
+			}
+		}
+	}
+
+	for _, movement := range movements {
+		query := `
+ 			INSERT INTO "stock_movements" (foodscale_id, location_id, kind, quantity, transfer_id, reference, note, created_by)
+ 			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ 			RETURNING id, created_at `
+
+		args := []interface{}{
+			movement.FoodScaleID,
+			movement.LocationID,
+			movement.Kind,
+			movement.Quantity,
+			movement.TransferID,
+			movement.Reference,
+			movement.Note,
+			movement.CreatedBy,
+		}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&movement.ID, &movement.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if m.stats != nil {
+		m.stats.invalidate()
+	}
+	return nil
+}
+
+// NewTransfer returns the two movements that move quantity units of the scale
+// from one location to another, linked by a fresh transfer id.
+func (m InventoryModel) NewTransfer(foodscaleID, from, to int64, quantity int) ([]*StockMovement, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var transferID int64
+	err := m.DB.QueryRowContext(ctx, `SELECT nextval('stock_transfers_seq')`).Scan(&transferID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*StockMovement{
+		{FoodScaleID: foodscaleID, LocationID: from, Kind: StockTransferOut, Quantity: -quantity, TransferID: &transferID},
+		{FoodScaleID: foodscaleID, LocationID: to, Kind: StockTransferIn, Quantity: quantity, TransferID: &transferID},
+	}, nil
+}
+
+// GetLevels returns the quantities of the scale on hand per location, leaving
+// out locations that never held it.
+func (m InventoryModel) GetLevels(foodscaleID int64) ([]*StockLevel, error) {
+	query := `
+ 		SELECT sl.foodscale_id, '', sl.location_id, l.code, sl.on_hand, sl.updated_at
+ 		FROM "stock_levels" sl
+ 		JOIN "locations" l ON l.id = sl.location_id
+ 		WHERE sl.foodscale_id = $1
+ 		ORDER BY l.code `
+
+	levels, _, err := m.getLevels(query, nil, foodscaleID)
+	return levels, err
+}
+
+// GetLevelsAtLocation returns a page of the scales held at the location,
+// leaving out scales in the trash and, when inStockOnly is set, those with
+// nothing on hand.
+func (m InventoryModel) GetLevelsAtLocation(locationID int64, inStockOnly bool, filters Filters) ([]*StockLevel, Metadata, error) {
+	query := `
+ 		SELECT count(*) OVER(), sl.foodscale_id, fs.model, sl.location_id, '', sl.on_hand, sl.updated_at
+ 		FROM "stock_levels" sl
+ 		JOIN "FoodScales" fs ON fs.id = sl.foodscale_id
+ 		WHERE sl.location_id = $1 AND fs.deleted_at IS NULL AND (sl.on_hand > 0 OR NOT $2)
+ 		ORDER BY fs.model, fs.id
+ 		LIMIT $3 OFFSET $4 `
+
+	return m.getLevels(query, &filters, locationID, inStockOnly, filters.limit(), filters.offset())
+}
+
+// getLevels runs a stock level query. With filters set its rows start with
+// the total count and the result is paginated.
+func (m InventoryModel) getLevels(query string, filters *Filters, args ...interface{}) ([]*StockLevel, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	levels := []*StockLevel{}
+
+	for rows.Next() {
+		var level StockLevel
+
+		targets := []interface{}{&level.FoodScaleID, &level.Model, &level.LocationID, &level.LocationCode, &level.OnHand, &level.UpdatedAt}
+		if filters != nil {
+			targets = append([]interface{}{&totalRecords}, targets...)
+		}
+
+		err := rows.Scan(targets...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		levels = append(levels, &level)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var metadata Metadata
+	if filters != nil {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	}
+	return levels, metadata, nil
+}
+
+// GetMovements returns a page of the scale's ledger, at a single location when
+// locationID is not zero.
+func (m InventoryModel) GetMovements(foodscaleID, locationID int64, filters Filters) ([]*StockMovement, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), id, created_at, foodscale_id, location_id, kind, quantity, transfer_id, reference, note, created_by
+ 		FROM "stock_movements"
+ 		WHERE foodscale_id = $1 AND (location_id = $2 OR $2 = 0)
+ 		ORDER BY %s %s, id %[2]s
+ 		LIMIT $3 OFFSET $4 `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, foodscaleID, locationID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movements := []*StockMovement{}
+
+	for rows.Next() {
+		var movement StockMovement
+		err := rows.Scan(
+			&totalRecords,
+			&movement.ID,
+			&movement.CreatedAt,
+			&movement.FoodScaleID,
+			&movement.LocationID,
+			&movement.Kind,
+			&movement.Quantity,
+			&movement.TransferID,
+			&movement.Reference,
+			&movement.Note,
+			&movement.CreatedBy,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		movements = append(movements, &movement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return movements, metadata, nil
+}
+
+func isLocationViolation(err error) bool {
+	return strings.HasPrefix(err.Error(), `pq: insert or update on table "stock_levels" violates foreign key constraint "stock_levels_location_id_fkey"`)
+}
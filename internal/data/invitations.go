@@ -0,0 +1,275 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// InvitationRoles maps the roles an admin can pick when inviting someone to
+// the permissions the new account is granted on acceptance.
+var InvitationRoles = map[string]Permissions{
+	"reader": {"scales:read", "foods:read"},
+	"writer": {"scales:read", "scales:write", "foods:read", "foods:write"},
+	"admin":  {"scales:read", "scales:write", "scales:admin", "foods:read", "foods:write", "users:admin", "audit:read"},
+}
+
+type Invitation struct {
+	ID             int64      `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	Email          string     `json:"email"`
+	Role           string     `json:"role"`
+	InvitedBy      *int64     `json:"invited_by,omitempty"`
+	Expiry         time.Time  `json:"expiry"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+	AcceptedUserID *int64     `json:"accepted_user_id,omitempty"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	Status         string     `json:"status"`
+}
+
+func ValidateInvitation(v *validator.Validator, invitation *Invitation) {
+	ValidateEmail(v, invitation.Email)
+
+	_, ok := InvitationRoles[invitation.Role]
+	v.Check(invitation.Role != "", "role", "must be provided")
+	v.Check(ok, "role", "must be one of reader, writer or admin")
+}
+
+// invitationStatus is the SQL expression deriving an invitation's status from
+// its timestamps. It is shared by the select lists and the status filter.
+const invitationStatus = `
+ 		CASE
+ 			WHEN revoked_at IS NOT NULL THEN 'revoked'
+ 			WHEN accepted_at IS NOT NULL THEN 'accepted'
+ 			WHEN expiry <= NOW() THEN 'expired'
+ 			ELSE 'pending'
+ 		END `
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// New stores the invitation together with the hash of a freshly generated
+// invitation token and returns the token so the plaintext can be mailed.
+func (m InvitationModel) New(invitation *Invitation, ttl time.Duration) (*Token, error) {
+	var invitedBy int64
+	if invitation.InvitedBy != nil {
+		invitedBy = *invitation.InvitedBy
+	}
+
+	token, err := generateToken(invitedBy, ttl, ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+ 		INSERT INTO "invitations" (email, role, invited_by, token_hash, expiry)
+ 		VALUES ($1, $2, $3, $4, $5)
+ 		RETURNING id, created_at, expiry `
+
+	args := []interface{}{invitation.Email, invitation.Role, invitation.InvitedBy, token.Hash, token.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt, &invitation.Expiry)
+	if err != nil {
+		return nil, err
+	}
+	invitation.Status = InvitationPending
+	return token, nil
+}
+
+// GetForToken returns the pending invitation matching the plaintext token.
+// Accepted, revoked and expired invitations are reported as not found.
+func (m InvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+ 		SELECT id, created_at, email, role, invited_by, expiry, accepted_at, accepted_user_id, revoked_at, ` + invitationStatus + `
+ 		FROM "invitations"
+ 		WHERE token_hash = $1
+ 		AND accepted_at IS NULL
+ 		AND revoked_at IS NULL
+ 		AND expiry > $2 `
+
+	var invitation Invitation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tokenHash[:], time.Now()).Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.InvitedBy,
+		&invitation.Expiry,
+		&invitation.AcceptedAt,
+		&invitation.AcceptedUserID,
+		&invitation.RevokedAt,
+		&invitation.Status,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &invitation, nil
+}
+
+func (m InvitationModel) GetAll(email string, status string, filters Filters) ([]*Invitation, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), id, created_at, email, role, invited_by, expiry, accepted_at, accepted_user_id, revoked_at, %s
+ 		FROM "invitations"
+ 		WHERE (email = $1 OR $1 = '')
+ 		AND (%s = $2 OR $2 = '')
+ 		ORDER BY %s %s, id ASC
+ 		LIMIT $3 OFFSET $4 `, invitationStatus, invitationStatus, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{email, status, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var invitation Invitation
+		err := rows.Scan(
+			&totalRecords,
+			&invitation.ID,
+			&invitation.CreatedAt,
+			&invitation.Email,
+			&invitation.Role,
+			&invitation.InvitedBy,
+			&invitation.Expiry,
+			&invitation.AcceptedAt,
+			&invitation.AcceptedUserID,
+			&invitation.RevokedAt,
+			&invitation.Status,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		invitations = append(invitations, &invitation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return invitations, metadata, nil
+}
+
+// Revoke invalidates a pending invitation. Invitations that were already
+// accepted or revoked are reported as not found.
+func (m InvitationModel) Revoke(id int64) error {
+	query := `
+ 		UPDATE "invitations"
+ 		SET revoked_at = NOW()
+ 		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Accept creates the user from the invitation, grants the permissions of the
+// invitation's role and marks it accepted, all in one transaction. The
+// invitation row is locked first, so concurrent accepts and revokes wait;
+// ErrEditConflict is returned when it was used, revoked or expired in the
+// meantime, and ErrDuplicateEmail when the address already has an account.
+func (m InvitationModel) Accept(invitation *Invitation, user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+ 		SELECT 1 FROM "invitations"
+ 		WHERE id = $1 AND accepted_at IS NULL AND revoked_at IS NULL AND expiry > NOW()
+ 		FOR UPDATE `
+
+	var found int
+	err = tx.QueryRowContext(ctx, query, invitation.ID).Scan(&found)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	err = addPermissionsForUser(ctx, tx, user.ID, InvitationRoles[invitation.Role])
+	if err != nil {
+		return err
+	}
+
+	query = `
+ 		UPDATE "invitations"
+ 		SET accepted_at = NOW(), accepted_user_id = $1
+ 		WHERE id = $2
+ 		RETURNING accepted_at `
+
+	err = tx.QueryRowContext(ctx, query, user.ID, invitation.ID).Scan(&invitation.AcceptedAt)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	invitation.AcceptedUserID = &user.ID
+	invitation.Status = InvitationAccepted
+	return nil
+}
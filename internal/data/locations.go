@@ -0,0 +1,169 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrDuplicateLocationCode = errors.New("duplicate location code")
+	ErrUnknownLocation       = errors.New("unknown location")
+)
+
+var LocationCodeRX = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Location is a warehouse, shop or other place stock is kept at.
+type Location struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Address   string    `json:"address,omitempty"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateLocation(v *validator.Validator, location *Location) {
+	v.Check(location.Code != "", "code", "must be provided")
+	v.Check(len(location.Code) <= 32, "code", "must not be more than 32 bytes long")
+	v.Check(validator.Matches(location.Code, LocationCodeRX), "code", "must only contain letters, digits, dots, dashes and underscores")
+	v.Check(location.Name != "", "name", "must be provided")
+	v.Check(len(location.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(location.Address) <= 500, "address", "must not be more than 500 bytes long")
+}
+
+type LocationModel struct {
+	DB *sql.DB
+}
+
+func (m LocationModel) Insert(location *Location) error {
+	query := `
+ 		INSERT INTO "locations" (code, name, address)
+ 		VALUES ($1, $2, $3)
+ 		RETURNING id, created_at, version `
+
+	args := []interface{}{location.Code, location.Name, location.Address}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&location.ID, &location.CreatedAt, &location.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "locations_code_idx"`:
+			return ErrDuplicateLocationCode
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m LocationModel) Get(id int64) (*Location, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT id, created_at, code, name, address, version
+ 		FROM "locations"
+ 		WHERE id = $1 `
+
+	var location Location
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&location.ID,
+		&location.CreatedAt,
+		&location.Code,
+		&location.Name,
+		&location.Address,
+		&location.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &location, nil
+}
+
+func (m LocationModel) GetAll(filters Filters) ([]*Location, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), id, created_at, code, name, address, version
+ 		FROM "locations"
+ 		ORDER BY %s %s, id ASC
+ 		LIMIT $1 OFFSET $2 `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	locations := []*Location{}
+
+	for rows.Next() {
+		var location Location
+		err := rows.Scan(
+			&totalRecords,
+			&location.ID,
+			&location.CreatedAt,
+			&location.Code,
+			&location.Name,
+			&location.Address,
+			&location.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		locations = append(locations, &location)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return locations, metadata, nil
+}
+
+func (m LocationModel) Update(location *Location) error {
+	query := `
+ 		UPDATE "locations"
+ 		SET code = $1, name = $2, address = $3, version = version + 1
+ 		WHERE id = $4 AND version = $5
+ 		RETURNING version `
+
+	args := []interface{}{location.Code, location.Name, location.Address, location.ID, location.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&location.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "locations_code_idx"`:
+			return ErrDuplicateLocationCode
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// QueuedMail is an email waiting in the mail queue. Data holds the values the
+// template is rendered with, as they were stored.
+type QueuedMail struct {
+	ID        int64
+	Recipient string
+	Template  string
+	Data      map[string]interface{}
+	Attempts  int
+}
+
+// MailQueueModel stores outgoing email in the database so it is delivered
+// even if the process stops before sending it. Messages are claimed for a
+// lease; a message whose lease runs out without being marked sent or failed
+// is picked up again.
+type MailQueueModel struct {
+	DB *sql.DB
+}
+
+func (m MailQueueModel) Enqueue(recipient, template string, data interface{}) error {
+	return enqueueMail(m.DB, recipient, template, data)
+}
+
+// enqueueMail queues a message through q, so it can be part of a larger
+// transaction.
+func enqueueMail(q queryer, recipient, template string, data interface{}) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+ 		INSERT INTO "mail_queue" (recipient, template, data)
+ 		VALUES ($1, $2, $3) `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = q.ExecContext(ctx, query, recipient, template, string(js))
+	return err
+}
+
+// Claim takes up to limit messages that are due, have been tried fewer than
+// maxAttempts times and are not leased by another worker, and leases them for
+// the given duration.
+func (m MailQueueModel) Claim(limit, maxAttempts int, lease time.Duration) ([]*QueuedMail, error) {
+	query := `
+ 		UPDATE "mail_queue"
+ 		SET attempts = attempts + 1, next_attempt_at = NOW() + make_interval(secs => $3)
+ 		WHERE id IN (
+ 			SELECT id FROM "mail_queue"
+ 			WHERE sent_at IS NULL AND next_attempt_at <= NOW() AND attempts < $2
+ 			ORDER BY next_attempt_at, id
+ 			LIMIT $1
+ 			FOR UPDATE SKIP LOCKED)
+ 		RETURNING id, recipient, template, data, attempts `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, maxAttempts, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*QueuedMail{}
+
+	for rows.Next() {
+		var message QueuedMail
+		var data []byte
+
+		err := rows.Scan(&message.ID, &message.Recipient, &message.Template, &data, &message.Attempts)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(data, &message.Data)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (m MailQueueModel) MarkSent(id int64) error {
+	query := `
+ 		UPDATE "mail_queue"
+ 		SET sent_at = NOW(), last_error = NULL
+ 		WHERE id = $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed records why sending failed and when to try again.
+func (m MailQueueModel) MarkFailed(id int64, sendErr error, retryAt time.Time) error {
+	query := `
+ 		UPDATE "mail_queue"
+ 		SET last_error = $1, next_attempt_at = $2
+ 		WHERE id = $3 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, sendErr.Error(), retryAt, id)
+	return err
+}
+
+// DeleteSent removes messages sent before the cutoff and reports how many
+// were removed. Messages that gave up are kept for inspection.
+func (m MailQueueModel) DeleteSent(cutoff time.Time) (int64, error) {
+	query := `
+ 		DELETE FROM "mail_queue"
+ 		WHERE sent_at < $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
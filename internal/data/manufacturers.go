@@ -0,0 +1,176 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+var (
+	ErrDuplicateManufacturerName = errors.New("duplicate manufacturer name")
+	ErrUnknownManufacturer       = errors.New("unknown manufacturer")
+)
+
+type Manufacturer struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Country   string    `json:"country,omitempty"`
+	Website   string    `json:"website,omitempty"`
+}
+
+func ValidateManufacturer(v *validator.Validator, manufacturer *Manufacturer) {
+	v.Check(manufacturer.Name != "", "name", "must be provided")
+	v.Check(len(manufacturer.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(len(manufacturer.Country) <= 100, "country", "must not be more than 100 bytes long")
+	v.Check(len(manufacturer.Website) <= 500, "website", "must not be more than 500 bytes long")
+}
+
+type ManufacturerModel struct {
+	DB *sql.DB
+}
+
+func (m ManufacturerModel) Insert(manufacturer *Manufacturer) error {
+	query := `
+ 		INSERT INTO "manufacturers" (name, country, website)
+ 		VALUES ($1, $2, $3)
+ 		RETURNING id, created_at `
+
+	args := []interface{}{manufacturer.Name, manufacturer.Country, manufacturer.Website}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&manufacturer.ID, &manufacturer.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "manufacturers_name_idx"`:
+			return ErrDuplicateManufacturerName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (m ManufacturerModel) Get(id int64) (*Manufacturer, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT id, created_at, name, country, website
+ 		FROM "manufacturers"
+ 		WHERE id = $1 `
+
+	var manufacturer Manufacturer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&manufacturer.ID,
+		&manufacturer.CreatedAt,
+		&manufacturer.Name,
+		&manufacturer.Country,
+		&manufacturer.Website,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &manufacturer, nil
+}
+
+// GetForIDs returns the manufacturers with the given ids keyed by id. Ids
+// without a manufacturer are left out.
+func (m ManufacturerModel) GetForIDs(ids []int64) (map[int64]*Manufacturer, error) {
+	query := `
+ 		SELECT id, created_at, name, country, website
+ 		FROM "manufacturers"
+ 		WHERE id = ANY($1) `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	manufacturers := make(map[int64]*Manufacturer)
+
+	for rows.Next() {
+		var manufacturer Manufacturer
+		err := rows.Scan(
+			&manufacturer.ID,
+			&manufacturer.CreatedAt,
+			&manufacturer.Name,
+			&manufacturer.Country,
+			&manufacturer.Website,
+		)
+		if err != nil {
+			return nil, err
+		}
+		manufacturers[manufacturer.ID] = &manufacturer
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return manufacturers, nil
+}
+
+func (m ManufacturerModel) GetAll(name string, filters Filters) ([]*Manufacturer, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), id, created_at, name, country, website
+ 		FROM "manufacturers"
+ 		WHERE (name ILIKE '%%' || $1 || '%%' OR $1 = '')
+ 		ORDER BY %s %s, id ASC
+ 		LIMIT $2 OFFSET $3 `, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, name, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	manufacturers := []*Manufacturer{}
+
+	for rows.Next() {
+		var manufacturer Manufacturer
+		err := rows.Scan(
+			&totalRecords,
+			&manufacturer.ID,
+			&manufacturer.CreatedAt,
+			&manufacturer.Name,
+			&manufacturer.Country,
+			&manufacturer.Website,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		manufacturers = append(manufacturers, &manufacturer)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return manufacturers, metadata, nil
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -11,17 +12,59 @@ var (
 )
 
 type Models struct {
-	FoodScales  FoodScaleModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	FoodScales        FoodScaleModel
+	FoodScaleVersions FoodScaleVersionModel
+	Users             UserModel
+	Tokens            TokenModel
+	Permissions       PermissionModel
+	ACL               ACLModel
+	Groups            GroupModel
+	Invitations       InvitationModel
+	Audit             AuditModel
+	Idempotency       IdempotencyModel
+	Manufacturers     ManufacturerModel
+	Favorites         FavoriteModel
+	Watchlists        WatchlistModel
+	PriceAlerts       PriceAlertModel
+	MailQueue         MailQueueModel
+	Reviews           ReviewModel
+	Attachments       AttachmentModel
+	Locations         LocationModel
+	Inventory         InventoryModel
+	Calibrations      CalibrationModel
+	Devices           DeviceModel
+	Readings          ReadingModel
+	Foods             FoodModel
 }
 
 func NewModels(db *sql.DB) Models {
+	// Statistics can be filtered on stock and are limited to the scales a user
+	// can see, so the inventory, ACL and groups clear them too.
+	stats := newStatsCache(5 * time.Minute)
+
 	return Models{
-		FoodScales:  FoodScaleModel{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Permissions: PermissionModel{DB: db},
+		FoodScales:        FoodScaleModel{DB: db, stats: stats},
+		FoodScaleVersions: FoodScaleVersionModel{DB: db},
+		Users:             UserModel{DB: db},
+		Tokens:            TokenModel{DB: db},
+		Permissions:       PermissionModel{DB: db},
+		ACL:               ACLModel{DB: db, stats: stats},
+		Groups:            GroupModel{DB: db, stats: stats},
+		Invitations:       InvitationModel{DB: db},
+		Audit:             AuditModel{DB: db},
+		Idempotency:       IdempotencyModel{DB: db},
+		Manufacturers:     ManufacturerModel{DB: db},
+		Favorites:         FavoriteModel{DB: db},
+		Watchlists:        WatchlistModel{DB: db},
+		PriceAlerts:       PriceAlertModel{DB: db},
+		MailQueue:         MailQueueModel{DB: db},
+		Reviews:           ReviewModel{DB: db},
+		Attachments:       AttachmentModel{DB: db},
+		Locations:         LocationModel{DB: db},
+		Inventory:         InventoryModel{DB: db, stats: stats},
+		Calibrations:      CalibrationModel{DB: db},
+		Devices:           DeviceModel{DB: db},
+		Readings:          ReadingModel{DB: db},
+		Foods:             FoodModel{DB: db},
 	}
 }
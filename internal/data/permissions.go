@@ -3,10 +3,14 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/lib/pq"
 	"time"
 )
 
+var ErrUnknownPermission = errors.New("unknown permission")
+
 type Permissions []string
 
 func (p Permissions) Include(code string) bool {
@@ -18,6 +22,16 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// IncludeAll reports whether p holds every permission in codes.
+func (p Permissions) IncludeAll(codes Permissions) bool {
+	for _, code := range codes {
+		if !p.Include(code) {
+			return false
+		}
+	}
+	return true
+}
+
 type PermissionModel struct {
 	DB *sql.DB
 }
@@ -51,12 +65,44 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	return permissions, nil
 }
 
+// AddForUser grants the permissions to the user. It fails with
+// ErrUnknownPermission, granting nothing, when a code does not exist.
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = addPermissionsForUser(ctx, tx, userID, codes)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addPermissionsForUser grants the permissions through tx, returning
+// ErrUnknownPermission when fewer permissions were found than codes given.
+func addPermissionsForUser(ctx context.Context, tx *sql.Tx, userID int64, codes []string) error {
 	query := `
  		INSERT INTO "users_permissions"
  		SELECT $1, "permissions".id FROM "permissions" WHERE "permissions".code = ANY($2) `
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+
+	result, err := tx.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected < int64(len(codes)) {
+		return fmt.Errorf("%w: granted %d of %v", ErrUnknownPermission, rowsAffected, codes)
+	}
+	return nil
 }
@@ -0,0 +1,445 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// PriceAlert asks for an email once the price of a scale drops to or below
+// TargetPrice. An alert fires once and is re-armed when the price rises above
+// the target again. Model and Price describe the scale as it is now.
+type PriceAlert struct {
+	ID          int64      `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UserID      int64      `json:"user_id"`
+	FoodScaleID int64      `json:"foodscale_id"`
+	Model       string     `json:"model"`
+	Price       float32    `json:"price"`
+	TargetPrice float64    `json:"target_price"`
+	TriggeredAt *time.Time `json:"triggered_at"`
+}
+
+func ValidatePriceAlert(v *validator.Validator, alert *PriceAlert) {
+	v.Check(alert.TargetPrice > 0, "target_price", "must be greater than zero")
+	v.Check(alert.TargetPrice <= 1000, "target_price", "must not be more than 1000")
+}
+
+// PriceAlertSettings is how a user receives price alerts. Users who never
+// changed them get a daily digest.
+type PriceAlertSettings struct {
+	DailyDigest  bool       `json:"daily_digest"`
+	Subscribed   bool       `json:"subscribed"`
+	LastDigestAt *time.Time `json:"last_digest_at"`
+}
+
+// PriceDrop is one scale in a price alert email.
+type PriceDrop struct {
+	FoodScaleID int64     `json:"foodscale_id"`
+	Model       string    `json:"model"`
+	TargetPrice float64   `json:"target_price"`
+	Price       float32   `json:"price"`
+	At          time.Time `json:"at"`
+}
+
+// PriceAlertDigest holds the values a price alert email is rendered with.
+type PriceAlertDigest struct {
+	Name             string       `json:"name"`
+	Drops            []*PriceDrop `json:"drops"`
+	UnsubscribeToken string       `json:"unsubscribe_token"`
+}
+
+// withPriceAlerts wraps a statement that writes scales and returns the id and
+// price of each written row. In the same statement, alerts whose target the
+// new price has reached fire, recording a notification, and fired alerts the
+// price has risen above again are re-armed. The wrapped statement returns
+// selectList from the written rows.
+func withPriceAlerts(write, selectList string) string {
+	return `
+ 		WITH written AS (` + write + `),
+ 		changed AS (
+ 			UPDATE "price_alerts" pa
+ 			SET triggered_at = CASE WHEN w.price <= pa.target_price THEN NOW() END
+ 			FROM written w
+ 			WHERE pa.foodscale_id = w.id AND (pa.triggered_at IS NULL) = (w.price <= pa.target_price)
+ 			RETURNING pa.user_id, pa.foodscale_id, pa.target_price, w.price, pa.triggered_at IS NOT NULL AS fired),
+ 		notified AS (
+ 			INSERT INTO "price_alert_notifications" (user_id, foodscale_id, target_price, price)
+ 			SELECT user_id, foodscale_id, target_price, price FROM changed WHERE fired)
+ 		SELECT ` + selectList + ` FROM written `
+}
+
+type PriceAlertModel struct {
+	DB *sql.DB
+}
+
+// Upsert sets the user's alert for the scale, replacing the target of an
+// existing one. An alert whose target the price already meets starts out
+// fired, so it only notifies after the price has gone up and come down again.
+// It returns ErrRecordNotFound when the scale does not exist or is in the
+// trash.
+func (m PriceAlertModel) Upsert(alert *PriceAlert) error {
+	query := `
+ 		INSERT INTO "price_alerts" (user_id, foodscale_id, target_price, triggered_at)
+ 		SELECT $1, id, $3::numeric, CASE WHEN price <= $3::numeric THEN NOW() END
+ 		FROM "FoodScales"
+ 		WHERE id = $2 AND deleted_at IS NULL
+ 		ON CONFLICT (user_id, foodscale_id) DO UPDATE
+ 		SET target_price = EXCLUDED.target_price, triggered_at = EXCLUDED.triggered_at
+ 		RETURNING id `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, alert.UserID, alert.FoodScaleID, alert.TargetPrice).Scan(&alert.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	stored, err := m.Get(alert.UserID, alert.FoodScaleID)
+	if err != nil {
+		return err
+	}
+	*alert = *stored
+	return nil
+}
+
+const priceAlertColumns = `
+ 		pa.id, pa.created_at, pa.user_id, pa.foodscale_id, fs.model, fs.price, pa.target_price::float8, pa.triggered_at `
+
+func (alert *PriceAlert) scanTargets() []interface{} {
+	return []interface{}{
+		&alert.ID,
+		&alert.CreatedAt,
+		&alert.UserID,
+		&alert.FoodScaleID,
+		&alert.Model,
+		&alert.Price,
+		&alert.TargetPrice,
+		&alert.TriggeredAt,
+	}
+}
+
+func (m PriceAlertModel) Get(userID, foodscaleID int64) (*PriceAlert, error) {
+	query := `
+ 		SELECT ` + priceAlertColumns + `
+ 		FROM "price_alerts" pa
+ 		JOIN "FoodScales" fs ON fs.id = pa.foodscale_id
+ 		WHERE pa.user_id = $1 AND pa.foodscale_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var alert PriceAlert
+
+	err := m.DB.QueryRowContext(ctx, query, userID, foodscaleID).Scan(alert.scanTargets()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &alert, nil
+}
+
+// GetAllForUser returns the user's alerts, leaving out those on scales in the
+// trash.
+func (m PriceAlertModel) GetAllForUser(userID int64) ([]*PriceAlert, error) {
+	query := `
+ 		SELECT ` + priceAlertColumns + `
+ 		FROM "price_alerts" pa
+ 		JOIN "FoodScales" fs ON fs.id = pa.foodscale_id
+ 		WHERE pa.user_id = $1 AND fs.deleted_at IS NULL
+ 		ORDER BY pa.created_at, pa.id `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []*PriceAlert{}
+
+	for rows.Next() {
+		var alert PriceAlert
+		err := rows.Scan(alert.scanTargets()...)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &alert)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (m PriceAlertModel) Delete(userID, foodscaleID int64) error {
+	query := `
+ 		DELETE FROM "price_alerts"
+ 		WHERE user_id = $1 AND foodscale_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, foodscaleID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+func (m PriceAlertModel) GetSettings(userID int64) (*PriceAlertSettings, error) {
+	query := `
+ 		SELECT daily_digest, unsubscribed_at IS NULL, last_digest_at
+ 		FROM "price_alert_settings"
+ 		WHERE user_id = $1 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	settings := PriceAlertSettings{DailyDigest: true, Subscribed: true}
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&settings.DailyDigest, &settings.Subscribed, &settings.LastDigestAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+func (m PriceAlertModel) UpdateSettings(userID int64, settings *PriceAlertSettings) error {
+	query := `
+ 		INSERT INTO "price_alert_settings" (user_id, daily_digest, unsubscribed_at)
+ 		VALUES ($1, $2, CASE WHEN $3::boolean THEN NULL ELSE NOW() END)
+ 		ON CONFLICT (user_id) DO UPDATE
+ 		SET daily_digest = EXCLUDED.daily_digest,
+ 			unsubscribed_at = CASE WHEN $3::boolean THEN NULL ELSE coalesce("price_alert_settings".unsubscribed_at, NOW()) END
+ 		RETURNING last_digest_at `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, userID, settings.DailyDigest, settings.Subscribed).Scan(&settings.LastDigestAt)
+}
+
+// Unsubscribe stops price alert emails for the user. Alerts stay in place and
+// pending notifications are dropped by the next QueueDigests.
+func (m PriceAlertModel) Unsubscribe(userID int64) error {
+	query := `
+ 		INSERT INTO "price_alert_settings" (user_id, unsubscribed_at)
+ 		VALUES ($1, NOW())
+ 		ON CONFLICT (user_id) DO UPDATE
+ 		SET unsubscribed_at = coalesce("price_alert_settings".unsubscribed_at, NOW()) `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// QueueDigests turns pending notifications into emails on the mail queue, one
+// per user, rendered with template. Users on the daily digest get at most one
+// email per digestInterval. Each email carries a fresh unsubscribe token valid
+// for unsubscribeTTL. It returns how many emails were queued.
+func (m PriceAlertModel) QueueDigests(template string, digestInterval, unsubscribeTTL time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+ 		DELETE FROM "price_alert_notifications" n
+ 		USING "price_alert_settings" s
+ 		WHERE s.user_id = n.user_id AND s.unsubscribed_at IS NOT NULL `
+
+	_, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	query = `
+ 		SELECT DISTINCT n.user_id
+ 		FROM "price_alert_notifications" n
+ 		LEFT JOIN "price_alert_settings" s ON s.user_id = n.user_id
+ 		WHERE s.user_id IS NULL OR NOT s.daily_digest OR s.last_digest_at IS NULL OR s.last_digest_at <= $1 `
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now().Add(-digestInterval))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var userIDs []int64
+
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			return 0, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, userID := range userIDs {
+		sent, err := m.queueDigest(userID, template, unsubscribeTTL)
+		if err != nil {
+			return queued, err
+		}
+		if sent {
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+// queueDigest queues the email for one user and removes the notifications it
+// covers in a single transaction. Notifications locked by another instance
+// doing the same are skipped, so nothing is sent twice.
+func (m PriceAlertModel) queueDigest(userID int64, template string, unsubscribeTTL time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+ 		SELECT n.id, n.created_at, n.foodscale_id, fs.model, n.target_price::float8, n.price, fs.deleted_at IS NOT NULL
+ 		FROM "price_alert_notifications" n
+ 		JOIN "FoodScales" fs ON fs.id = n.foodscale_id
+ 		WHERE n.user_id = $1
+ 		ORDER BY n.created_at, n.id
+ 		FOR UPDATE OF n SKIP LOCKED `
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	var drops []*PriceDrop
+	latest := make(map[int64]*PriceDrop)
+
+	for rows.Next() {
+		var id int64
+		var trashed bool
+		var drop PriceDrop
+
+		err := rows.Scan(&id, &drop.At, &drop.FoodScaleID, &drop.Model, &drop.TargetPrice, &drop.Price, &trashed)
+		if err != nil {
+			return false, err
+		}
+		ids = append(ids, id)
+
+		// A scale that dropped more than once is reported at its latest
+		// price; scales now in the trash are left out.
+		if trashed {
+			continue
+		}
+		if existing, ok := latest[drop.FoodScaleID]; ok {
+			*existing = drop
+			continue
+		}
+		latest[drop.FoodScaleID] = &drop
+		drops = append(drops, &drop)
+	}
+
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	query = `
+ 		DELETE FROM "price_alert_notifications"
+ 		WHERE id = ANY($1) `
+
+	_, err = tx.ExecContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return false, err
+	}
+
+	if len(drops) > 0 {
+		var name, email string
+
+		query = `
+ 			SELECT name, email
+ 			FROM "Users"
+ 			WHERE id = $1 `
+
+		err = tx.QueryRowContext(ctx, query, userID).Scan(&name, &email)
+		if err != nil {
+			return false, err
+		}
+
+		token, err := generateToken(userID, unsubscribeTTL, ScopePriceAlertUnsubscribe)
+		if err != nil {
+			return false, err
+		}
+
+		query = `
+ 			INSERT INTO "tokens" (hash, user_id, expiry, scope)
+ 			VALUES ($1, $2, $3, $4) `
+
+		_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+		if err != nil {
+			return false, err
+		}
+
+		digest := PriceAlertDigest{Name: name, Drops: drops, UnsubscribeToken: token.Plaintext}
+
+		err = enqueueMail(tx, email, template, digest)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	query = `
+ 		INSERT INTO "price_alert_settings" (user_id, last_digest_at)
+ 		VALUES ($1, NOW())
+ 		ON CONFLICT (user_id) DO UPDATE
+ 		SET last_digest_at = NOW() `
+
+	_, err = tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, err
+	}
+	return len(drops) > 0, nil
+}
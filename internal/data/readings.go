@@ -0,0 +1,227 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"math"
+	"time"
+)
+
+const (
+	MaxReadingsPerBatch = 1000
+	MaxReadingsPerQuery = 10000
+	MaxReadingBuckets   = 10000
+
+	// MaxReadingClockSkew is how far in the future a reading's timestamp may
+	// be, to allow for device clocks running a little fast.
+	MaxReadingClockSkew = 5 * time.Minute
+)
+
+// Reading is a weight measured by a device. Grams is the net weight shown to
+// the user and TareGrams the tare that was subtracted from the gross weight.
+// Stable is set when the scale had settled.
+type Reading struct {
+	RecordedAt time.Time `json:"recorded_at"`
+	Grams      float64   `json:"grams"`
+	TareGrams  float64   `json:"tare_grams"`
+	Stable     bool      `json:"stable"`
+}
+
+// ValidateReading checks one reading of a batch, reporting problems under key.
+func ValidateReading(v *validator.Validator, key string, reading Reading, now time.Time) {
+	v.Check(!reading.RecordedAt.IsZero(), key, "recorded_at must be provided")
+	v.Check(reading.RecordedAt.Year() >= 2000, key, "recorded_at must not be before 2000")
+	v.Check(!reading.RecordedAt.After(now.Add(MaxReadingClockSkew)), key, "recorded_at must not be in the future")
+	v.Check(!math.IsNaN(reading.Grams) && math.Abs(reading.Grams) <= 1e7, key, "grams must be a weight under 10000 kg")
+	v.Check(reading.TareGrams >= 0 && reading.TareGrams <= 1e7, key, "tare_grams must be a weight under 10000 kg")
+}
+
+// ReadingTimePlausible reports whether t passes the timestamp checks of
+// ValidateReading.
+func ReadingTimePlausible(t, now time.Time) bool {
+	return t.Year() >= 2000 && !t.After(now.Add(MaxReadingClockSkew))
+}
+
+// ReadingBucket summarises the readings of a device within one interval.
+type ReadingBucket struct {
+	Start     time.Time `json:"start"`
+	Count     int       `json:"count"`
+	MinGrams  float64   `json:"min_grams"`
+	MaxGrams  float64   `json:"max_grams"`
+	AvgGrams  float64   `json:"avg_grams"`
+	LastGrams float64   `json:"last_grams"`
+}
+
+// ReadingQuery selects the readings of a device recorded at or after From and
+// before To. With StableOnly set, readings taken while the scale was settling
+// are left out.
+type ReadingQuery struct {
+	DeviceID   int64
+	From       time.Time
+	To         time.Time
+	StableOnly bool
+}
+
+// IngestResult counts the readings of a batch that were stored and the ones
+// dropped as retransmissions. Skipped counts raw frames that decoded to a
+// state such as an overload rather than a weight.
+type IngestResult struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"`
+	Skipped    int `json:"skipped"`
+}
+
+type ReadingModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a batch of readings from the device. Readings are kept by
+// when they were recorded rather than when they arrived, so batches sent out
+// of order or after the device was offline fall into place. Timestamps are
+// kept to the millisecond, and a reading recorded at the same time as one
+// already stored is a retransmission and is dropped, so sending a batch again
+// is harmless.
+func (m ReadingModel) Insert(deviceID int64, readings []Reading) (*IngestResult, error) {
+	seen := make(map[int64]bool, len(readings))
+
+	var recordedAt []string
+	var grams, tare []float64
+	var stable []bool
+
+	for _, reading := range readings {
+		at := reading.RecordedAt.UTC().Truncate(time.Millisecond)
+		if seen[at.UnixMilli()] {
+			continue
+		}
+		seen[at.UnixMilli()] = true
+
+		recordedAt = append(recordedAt, at.Format(time.RFC3339Nano))
+		grams = append(grams, reading.Grams)
+		tare = append(tare, reading.TareGrams)
+		stable = append(stable, reading.Stable)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+ 		INSERT INTO "weight_readings" (device_id, recorded_at, grams, tare_grams, stable)
+ 		SELECT $1, r.*
+ 		FROM unnest($2::timestamptz[], $3::float8[], $4::float8[], $5::boolean[]) AS r
+ 		ON CONFLICT (device_id, recorded_at) DO NOTHING `
+
+	result, err := tx.ExecContext(ctx, query, deviceID, pq.Array(recordedAt), pq.Array(grams), pq.Array(tare), pq.Array(stable))
+	if err != nil {
+		return nil, err
+	}
+
+	accepted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+ 		UPDATE "devices"
+ 		SET last_seen_at = NOW()
+ 		WHERE id = $1 `
+
+	_, err = tx.ExecContext(ctx, query, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return &IngestResult{Accepted: int(accepted), Duplicates: len(readings) - int(accepted)}, nil
+}
+
+// GetRange returns up to limit readings in the range, oldest first, and
+// whether there were more. Clients continue from the last reading returned.
+func (m ReadingModel) GetRange(q ReadingQuery, limit int) ([]*Reading, bool, error) {
+	query := `
+ 		SELECT recorded_at, grams, tare_grams, stable
+ 		FROM "weight_readings"
+ 		WHERE device_id = $1 AND recorded_at >= $2 AND recorded_at < $3 AND (stable OR NOT $4)
+ 		ORDER BY recorded_at
+ 		LIMIT $5 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, q.DeviceID, q.From, q.To, q.StableOnly, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	readings := []*Reading{}
+
+	for rows.Next() {
+		var reading Reading
+		err := rows.Scan(&reading.RecordedAt, &reading.Grams, &reading.TareGrams, &reading.Stable)
+		if err != nil {
+			return nil, false, err
+		}
+		readings = append(readings, &reading)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	more := len(readings) > limit
+	if more {
+		readings = readings[:limit]
+	}
+	return readings, more, nil
+}
+
+// GetBuckets downsamples the readings in the range into buckets of the given
+// interval, aligned to the Unix epoch. Intervals without readings are left
+// out.
+func (m ReadingModel) GetBuckets(q ReadingQuery, interval time.Duration) ([]*ReadingBucket, error) {
+	query := `
+ 		SELECT to_timestamp(floor(extract(epoch FROM recorded_at)::float8 / $5::float8) * $5::float8) AS bucket,
+ 			count(*), min(grams), max(grams), avg(grams),
+ 			(array_agg(grams ORDER BY recorded_at DESC))[1]
+ 		FROM "weight_readings"
+ 		WHERE device_id = $1 AND recorded_at >= $2 AND recorded_at < $3 AND (stable OR NOT $4)
+ 		GROUP BY bucket
+ 		ORDER BY bucket `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, q.DeviceID, q.From, q.To, q.StableOnly, interval.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*ReadingBucket{}
+
+	for rows.Next() {
+		var bucket ReadingBucket
+		err := rows.Scan(&bucket.Start, &bucket.Count, &bucket.MinGrams, &bucket.MaxGrams, &bucket.AvgGrams, &bucket.LastGrams)
+		if err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, &bucket)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
@@ -0,0 +1,288 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+// ReviewStatuses lists the moderation states of a review. Only approved
+// reviews are shown to everyone and count towards a scale's rating.
+var ReviewStatuses = []string{ReviewPending, ReviewApproved, ReviewRejected}
+
+var ReviewSortSafelist = []string{"created_at", "rating", "-created_at", "-rating"}
+
+var (
+	ErrDuplicateReview = errors.New("duplicate review")
+)
+
+type Review struct {
+	ID             int64      `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	FoodScaleID    int64      `json:"foodscale_id"`
+	UserID         int64      `json:"user_id"`
+	Rating         int        `json:"rating"`
+	Body           string     `json:"body"`
+	Status         string     `json:"status"`
+	ModeratedBy    *int64     `json:"moderated_by,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+	ModerationNote string     `json:"moderation_note,omitempty"`
+	Version        int32      `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	v.Check(len(review.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+	v.Check(validator.In(review.Status, ReviewStatuses...), "status", "must be pending, approved or rejected")
+	v.Check(len(review.ModerationNote) <= 500, "moderation_note", "must not be more than 500 bytes long")
+}
+
+// ReviewQuery selects the reviews to list. With FoodScaleID nil reviews of
+// every scale are listed. Reviews with Status, or in any state when it is
+// empty, are listed along with, when ViewerID is set, all reviews written by
+// that user.
+type ReviewQuery struct {
+	FoodScaleID *int64
+	Status      string
+	ViewerID    int64
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+const reviewColumns = `
+ 		id, created_at, updated_at, foodscale_id, user_id, rating, body, status,
+ 		moderated_by, moderated_at, moderation_note, version `
+
+func (review *Review) scanTargets() []interface{} {
+	return []interface{}{
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.FoodScaleID,
+		&review.UserID,
+		&review.Rating,
+		&review.Body,
+		&review.Status,
+		&review.ModeratedBy,
+		&review.ModeratedAt,
+		&review.ModerationNote,
+		&review.Version,
+	}
+}
+
+// write runs fn in a transaction that holds a lock on the scale, then brings
+// the scale's rating aggregates up to date. Locking the scale first makes
+// concurrent writes to its reviews take turns, so the aggregates are always
+// computed from everything committed before. It returns ErrRecordNotFound when
+// the scale does not exist or is in the trash.
+func (m ReviewModel) write(foodscaleID int64, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+ 		SELECT id
+ 		FROM "FoodScales"
+ 		WHERE id = $1 AND deleted_at IS NULL
+ 		FOR UPDATE `
+
+	var id int64
+	err = tx.QueryRowContext(ctx, query, foodscaleID).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = fn(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	query = `
+ 		UPDATE "FoodScales"
+ 		SET (rating_avg, rating_count) = (
+ 			SELECT round(avg(rating), 2), count(*)
+ 			FROM "reviews"
+ 			WHERE foodscale_id = $1 AND status = $2)
+ 		WHERE id = $1 `
+
+	_, err = tx.ExecContext(ctx, query, foodscaleID, ReviewApproved)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Insert adds the review. A user can review each scale once.
+func (m ReviewModel) Insert(review *Review) error {
+	return m.write(review.FoodScaleID, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+ 			INSERT INTO "reviews" (foodscale_id, user_id, rating, body, status)
+ 			VALUES ($1, $2, $3, $4, $5)
+ 			RETURNING id, created_at, updated_at, version `
+
+		args := []interface{}{review.FoodScaleID, review.UserID, review.Rating, review.Body, review.Status}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+		if err != nil {
+			switch {
+			case err.Error() == `pq: duplicate key value violates unique constraint "reviews_foodscale_user_key"`:
+				return ErrDuplicateReview
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m ReviewModel) Get(foodscaleID, id int64) (*Review, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT ` + reviewColumns + `
+ 		FROM "reviews"
+ 		WHERE id = $1 AND foodscale_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var review Review
+
+	err := m.DB.QueryRowContext(ctx, query, id, foodscaleID).Scan(review.scanTargets()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &review, nil
+}
+
+// GetAll returns a page of the reviews selected by q. Reviews of scales in
+// the trash are left out.
+func (m ReviewModel) GetAll(q ReviewQuery, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+ 		SELECT count(*) OVER(), %s
+ 		FROM "reviews" r
+ 		WHERE ($1::bigint IS NULL OR r.foodscale_id = $1)
+ 		AND ($2 = '' OR r.status = $2 OR r.user_id = $3)
+ 		AND EXISTS (SELECT 1 FROM "FoodScales" fs WHERE fs.id = r.foodscale_id AND fs.deleted_at IS NULL)
+ 		ORDER BY r.%s %s, r.id ASC
+ 		LIMIT $4 OFFSET $5 `, reviewColumns, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{q.FoodScaleID, q.Status, q.ViewerID, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+		err := rows.Scan(append([]interface{}{&totalRecords}, review.scanTargets()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// Update writes the review if its version still matches.
+func (m ReviewModel) Update(review *Review) error {
+	return m.write(review.FoodScaleID, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+ 			UPDATE "reviews"
+ 			SET rating = $1, body = $2, status = $3, moderated_by = $4, moderated_at = $5, moderation_note = $6,
+ 				updated_at = NOW(), version = version + 1
+ 			WHERE id = $7 AND foodscale_id = $8 AND version = $9
+ 			RETURNING updated_at, version `
+
+		args := []interface{}{
+			review.Rating,
+			review.Body,
+			review.Status,
+			review.ModeratedBy,
+			review.ModeratedAt,
+			review.ModerationNote,
+			review.ID,
+			review.FoodScaleID,
+			review.Version,
+		}
+
+		err := tx.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt, &review.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrEditConflict
+			default:
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (m ReviewModel) Delete(review *Review) error {
+	return m.write(review.FoodScaleID, func(ctx context.Context, tx *sql.Tx) error {
+		query := `
+ 			DELETE FROM "reviews"
+ 			WHERE id = $1 AND foodscale_id = $2 `
+
+		result, err := tx.ExecContext(ctx, query, review.ID, review.FoodScaleID)
+		if err != nil {
+			return err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected == 0 {
+			return ErrRecordNotFound
+		}
+		return nil
+	})
+}
@@ -0,0 +1,301 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"fmt"
+	"github.com/lib/pq"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaxSimilarCandidates caps how many scales are scored for a similarity
+// search, and MaxSimilarResults how many of the best ones are returned.
+const (
+	MaxSimilarCandidates = 2000
+	MaxSimilarResults    = 100
+)
+
+// SimilarityWeights sets how much each attribute counts towards the distance
+// between two scales. Only the ratios between the weights matter.
+type SimilarityWeights struct {
+	Price      float64 `json:"price"`
+	Year       float64 `json:"year"`
+	Runtime    float64 `json:"runtime"`
+	Dimensions float64 `json:"dimensions"`
+	Model      float64 `json:"model"`
+}
+
+var DefaultSimilarityWeights = SimilarityWeights{
+	Price:      3,
+	Year:       1,
+	Runtime:    1,
+	Dimensions: 2,
+	Model:      2,
+}
+
+func ValidateSimilarityWeights(v *validator.Validator, w SimilarityWeights) {
+	for _, weight := range []struct {
+		key   string
+		value float64
+	}{
+		{"weight_price", w.Price},
+		{"weight_year", w.Year},
+		{"weight_runtime", w.Runtime},
+		{"weight_dimensions", w.Dimensions},
+		{"weight_model", w.Model},
+	} {
+		finite := !math.IsNaN(weight.value) && !math.IsInf(weight.value, 0)
+		v.Check(finite, weight.key, "must be a finite number")
+		v.Check(!finite || weight.value >= 0, weight.key, "must not be negative")
+	}
+
+	// A NaN sum has already been reported against the weight causing it.
+	sum := w.Price + w.Year + w.Runtime + w.Dimensions + w.Model
+	v.Check(sum > 0 || math.IsNaN(sum), "weights", "must not all be zero")
+	v.Check(!math.IsInf(sum, 1), "weights", "must not add up to infinity")
+}
+
+type SimilarScale struct {
+	Score     float64     `json:"score"`
+	FoodScale *FoodScales `json:"foodscale"`
+}
+
+// GetSimilar ranks the other scales visibleTo can see (all of them when it is
+// zero) by how close they are to the given one and returns a page of the best
+// MaxSimilarResults. The database only preselects candidates; they are scored
+// in Go by RankSimilar, so the ranking itself does not depend on it.
+func (m FoodScaleModel) GetSimilar(id int64, weights SimilarityWeights, visibleTo int64, filters Filters) ([]*SimilarScale, Metadata, error) {
+	target, err := m.Get(id)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	columns := foodScaleColumns(nil)
+
+	args := FoodScaleQuery{VisibleTo: visibleTo}.args()
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	// When there are more candidates than can be scored, the ones kept are
+	// those closest to the target by an approximation of RankSimilar's
+	// distance using the same weights. Numbers are normalised by their range
+	// across the candidates and the target, dimensions by their relative
+	// difference, and the model by pg_trgm similarity.
+	var distance []string
+	if weights.Price > 0 {
+		distance = append(distance, fmt.Sprintf("%s * coalesce(abs(price::float8 - %s) / nullif(greatest(max_price, %[2]s) - least(min_price, %[2]s), 0), 0)",
+			arg(weights.Price), arg(float64(target.Price))))
+	}
+	if weights.Year > 0 {
+		distance = append(distance, fmt.Sprintf("%s * coalesce(abs(year::float8 - %s) / nullif(greatest(max_year, %[2]s) - least(min_year, %[2]s), 0), 0)",
+			arg(weights.Year), arg(float64(target.Year))))
+	}
+	if weights.Runtime > 0 {
+		distance = append(distance, fmt.Sprintf("%s * coalesce(abs(runtime::float8 - %s) / nullif(greatest(max_runtime, %[2]s) - least(min_runtime, %[2]s), 0), 0)",
+			arg(weights.Runtime), arg(float64(target.Runtime))))
+	}
+	if weights.Dimensions > 0 {
+		distance = append(distance, fmt.Sprintf(`%s * (
+ 			SELECT coalesce(avg(CASE WHEN d.a IS NULL OR d.b IS NULL THEN 1
+ 				ELSE coalesce(abs(d.a - d.b) / nullif(greatest(abs(d.a), abs(d.b)), 0), 0) END), 0)
+ 			FROM unnest(dimensions::float8[], %s::float8[]) AS d(a, b))`,
+			arg(weights.Dimensions), arg(pq.Array(target.Dimensions))))
+	}
+	if weights.Model > 0 {
+		distance = append(distance, fmt.Sprintf("%s * (1 - similarity(model, %s))", arg(weights.Model), arg(target.Model)))
+	}
+	if len(distance) == 0 {
+		distance = append(distance, "0")
+	}
+
+	query := fmt.Sprintf(`
+ 		WITH candidates AS (
+ 			SELECT *,
+ 				min(price::float8) OVER () AS min_price, max(price::float8) OVER () AS max_price,
+ 				min(year::float8) OVER () AS min_year, max(year::float8) OVER () AS max_year,
+ 				min(runtime::float8) OVER () AS min_runtime, max(runtime::float8) OVER () AS max_runtime
+ 			FROM "FoodScales" fs
+ 			WHERE %s AND fs.id <> %s
+ 		)
+ 		SELECT %s
+ 		FROM candidates
+ 		ORDER BY %s, id
+ 		LIMIT %s `,
+		foodScaleSearchCondition, arg(target.ID), strings.Join(columns, ", "), strings.Join(distance, " + "), arg(MaxSimilarCandidates))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.db().QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	candidates := []*FoodScales{}
+
+	for rows.Next() {
+		var foodscale FoodScales
+		err := rows.Scan(foodscale.scanTargets(columns)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		candidates = append(candidates, &foodscale)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	ranked := RankSimilar(target, candidates, weights)
+	if len(ranked) > MaxSimilarResults {
+		ranked = ranked[:MaxSimilarResults]
+	}
+
+	metadata := calculateMetadata(len(ranked), filters.Page, filters.PageSize)
+
+	start := filters.offset()
+	if start > len(ranked) {
+		start = len(ranked)
+	}
+	end := start + filters.limit()
+	if end > len(ranked) {
+		end = len(ranked)
+	}
+
+	return ranked[start:end], metadata, nil
+}
+
+// RankSimilar scores every candidate against the target and returns them best
+// first. Price, year and runtime distances are normalised by the range of the
+// value across the target and candidates, dimensions by the largest possible
+// distance in that range, and the model distance is one minus its trigram
+// similarity. The weighted mean distance d gives a score of 1 - d.
+func RankSimilar(target *FoodScales, candidates []*FoodScales, w SimilarityWeights) []*SimilarScale {
+	all := append([]*FoodScales{target}, candidates...)
+
+	priceRange := valueRange(all, func(fs *FoodScales) float64 { return float64(fs.Price) })
+	yearRange := valueRange(all, func(fs *FoodScales) float64 { return float64(fs.Year) })
+	runtimeRange := valueRange(all, func(fs *FoodScales) float64 { return float64(fs.Runtime) })
+	dimensionRanges := dimensionRanges(all)
+
+	targetTrigrams := trigrams(target.Model)
+	total := w.Price + w.Year + w.Runtime + w.Dimensions + w.Model
+
+	ranked := make([]*SimilarScale, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		d := w.Price*normalisedDistance(float64(target.Price), float64(candidate.Price), priceRange) +
+			w.Year*normalisedDistance(float64(target.Year), float64(candidate.Year), yearRange) +
+			w.Runtime*normalisedDistance(float64(target.Runtime), float64(candidate.Runtime), runtimeRange) +
+			w.Dimensions*dimensionDistance(target.Dimensions, candidate.Dimensions, dimensionRanges) +
+			w.Model*(1-trigramSimilarity(targetTrigrams, trigrams(candidate.Model)))
+
+		score := 0.0
+		if total > 0 {
+			score = 1 - d/total
+		}
+
+		ranked = append(ranked, &SimilarScale{Score: math.Round(score*10000) / 10000, FoodScale: candidate})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].FoodScale.ID < ranked[j].FoodScale.ID
+	})
+
+	return ranked
+}
+
+func valueRange(all []*FoodScales, value func(*FoodScales) float64) float64 {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, fs := range all {
+		min = math.Min(min, value(fs))
+		max = math.Max(max, value(fs))
+	}
+	return max - min
+}
+
+func normalisedDistance(a, b, span float64) float64 {
+	if span == 0 {
+		return 0
+	}
+	return math.Abs(a-b) / span
+}
+
+func dimensionRanges(all []*FoodScales) []float64 {
+	var ranges []float64
+	for i := 0; ; i++ {
+		min, max := math.Inf(1), math.Inf(-1)
+		for _, fs := range all {
+			if i < len(fs.Dimensions) {
+				min = math.Min(min, float64(fs.Dimensions[i]))
+				max = math.Max(max, float64(fs.Dimensions[i]))
+			}
+		}
+		if math.IsInf(min, 1) {
+			return ranges
+		}
+		ranges = append(ranges, max-min)
+	}
+}
+
+// dimensionDistance is the Euclidean distance between two dimension vectors
+// with every component normalised, scaled to lie between 0 and 1. A component
+// missing from either vector counts as the largest distance.
+func dimensionDistance(a, b []float32, ranges []float64) float64 {
+	if len(ranges) == 0 {
+		return 0
+	}
+
+	sum := 0.0
+	for i, span := range ranges {
+		d := 1.0
+		if i < len(a) && i < len(b) {
+			d = normalisedDistance(float64(a[i]), float64(b[i]), span)
+		}
+		sum += d * d
+	}
+	return math.Sqrt(sum / float64(len(ranges)))
+}
+
+// trigrams splits text into the set of three-character sequences of its
+// words, padding each word the way PostgreSQL's pg_trgm does so both agree on
+// what counts as similar.
+func trigrams(text string) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+func trigramSimilarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for t := range a {
+		if _, ok := b[t]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
@@ -13,6 +13,9 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeInvitation     = "invitation"
+
+	ScopePriceAlertUnsubscribe = "price-alert-unsubscribe"
 )
 
 type Token struct {
@@ -0,0 +1,244 @@
+package data
+
+import (
+	"awesomeProject3/internal/validator"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDuplicateWatchlistName = errors.New("duplicate watchlist name")
+)
+
+type Watchlist struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Name      string    `json:"name"`
+	Shared    bool      `json:"shared"`
+	ItemCount int       `json:"item_count"`
+}
+
+func ValidateWatchlist(v *validator.Validator, watchlist *Watchlist) {
+	v.Check(watchlist.Name != "", "name", "must be provided")
+	v.Check(len(watchlist.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+// ShareToken is the secret part of a watchlist's share link. Only its hash
+// is stored, so the plaintext is shown once when sharing is turned on.
+type ShareToken struct {
+	Plaintext string `json:"token"`
+	Hash      []byte `json:"-"`
+}
+
+func GenerateShareToken() (*ShareToken, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &ShareToken{
+		Plaintext: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes),
+	}
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+	return token, nil
+}
+
+type WatchlistModel struct {
+	DB *sql.DB
+}
+
+// watchlistColumns selects a watchlist along with the number of its scales
+// that are not in the trash.
+const watchlistColumns = `
+ 		w.id, w.created_at, w.user_id, w.name, w.share_token_hash IS NOT NULL,
+ 		(SELECT count(*) FROM "watchlists_items" wi JOIN "FoodScales" fs ON fs.id = wi.foodscale_id
+ 		 WHERE wi.watchlist_id = w.id AND fs.deleted_at IS NULL) `
+
+func (watchlist *Watchlist) scanTargets() []interface{} {
+	return []interface{}{
+		&watchlist.ID,
+		&watchlist.CreatedAt,
+		&watchlist.UserID,
+		&watchlist.Name,
+		&watchlist.Shared,
+		&watchlist.ItemCount,
+	}
+}
+
+func (m WatchlistModel) Insert(watchlist *Watchlist) error {
+	query := `
+ 		INSERT INTO "watchlists" (user_id, name)
+ 		VALUES ($1, $2)
+ 		RETURNING id, created_at `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, watchlist.UserID, watchlist.Name).Scan(&watchlist.ID, &watchlist.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "watchlists_user_name_idx"`:
+			return ErrDuplicateWatchlistName
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the watchlist if it belongs to the user.
+func (m WatchlistModel) Get(id, userID int64) (*Watchlist, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+ 		SELECT ` + watchlistColumns + `
+ 		FROM "watchlists" w
+ 		WHERE w.id = $1 AND w.user_id = $2 `
+
+	return m.get(query, id, userID)
+}
+
+// GetForShareToken returns the watchlist shared under the token.
+func (m WatchlistModel) GetForShareToken(tokenPlaintext string) (*Watchlist, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+ 		SELECT ` + watchlistColumns + `
+ 		FROM "watchlists" w
+ 		WHERE w.share_token_hash = $1 `
+
+	return m.get(query, hash[:])
+}
+
+func (m WatchlistModel) get(query string, args ...interface{}) (*Watchlist, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var watchlist Watchlist
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(watchlist.scanTargets()...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &watchlist, nil
+}
+
+func (m WatchlistModel) GetAllForUser(userID int64) ([]*Watchlist, error) {
+	query := `
+ 		SELECT ` + watchlistColumns + `
+ 		FROM "watchlists" w
+ 		WHERE w.user_id = $1
+ 		ORDER BY lower(w.name), w.id `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watchlists := []*Watchlist{}
+
+	for rows.Next() {
+		var watchlist Watchlist
+		err := rows.Scan(watchlist.scanTargets()...)
+		if err != nil {
+			return nil, err
+		}
+		watchlists = append(watchlists, &watchlist)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return watchlists, nil
+}
+
+func (m WatchlistModel) Delete(id, userID int64) error {
+	query := `
+ 		DELETE FROM "watchlists"
+ 		WHERE id = $1 AND user_id = $2 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// SetShareToken turns sharing on with the token's hash, replacing any earlier
+// link, or turns it off when token is nil.
+func (m WatchlistModel) SetShareToken(watchlist *Watchlist, token *ShareToken) error {
+	var hash interface{}
+	if token != nil {
+		hash = token.Hash
+	}
+
+	query := `
+ 		UPDATE "watchlists"
+ 		SET share_token_hash = $1
+ 		WHERE id = $2 AND user_id = $3 `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, hash, watchlist.ID, watchlist.UserID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	watchlist.Shared = token != nil
+	return nil
+}
+
+func (m WatchlistModel) AddItem(watchlistID, foodscaleID int64) (time.Time, error) {
+	return addListedFoodScale(m.DB, `"watchlists_items"`, "watchlist_id", watchlistID, foodscaleID)
+}
+
+func (m WatchlistModel) RemoveItem(watchlistID, foodscaleID int64) error {
+	return removeListedFoodScale(m.DB, `"watchlists_items"`, "watchlist_id", watchlistID, foodscaleID)
+}
+
+func (m WatchlistModel) GetItems(watchlistID, visibleTo int64, filters Filters) ([]*ListedFoodScale, Metadata, error) {
+	return getListedFoodScales(m.DB, `"watchlists_items"`, "watchlist_id", watchlistID, visibleTo, filters)
+}
@@ -0,0 +1,453 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON documents.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch document")
+	ErrPathNotFound = errors.New("path not found")
+	ErrTestFailed   = errors.New("test failed")
+)
+
+// OperationError describes which operation of a JSON Patch could not be
+// applied and why. It wraps ErrInvalidPatch, ErrPathNotFound or ErrTestFailed.
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %s", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc and returns the result.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+	return t
+}
+
+// Apply applies an RFC 6902 patch to doc and returns the result. Operations
+// are applied in order and the first failing one aborts the whole patch.
+func Apply(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var ops []map[string]json.RawMessage
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	if err := dec.Decode(&ops); err != nil {
+		return nil, fmt.Errorf("%w: must be an array of operation objects", ErrInvalidPatch)
+	}
+
+	for i, raw := range ops {
+		op, err := parseOperation(raw)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.name, Path: op.path, Err: err}
+		}
+
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, &OperationError{Index: i, Op: op.name, Path: op.path, Err: err}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+type operation struct {
+	name     string
+	path     string
+	from     string
+	value    interface{}
+	hasValue bool
+}
+
+func parseOperation(raw map[string]json.RawMessage) (operation, error) {
+	var op operation
+
+	if err := unmarshalString(raw, "op", &op.name); err != nil {
+		return op, err
+	}
+	if err := unmarshalString(raw, "path", &op.path); err != nil {
+		return op, err
+	}
+
+	switch op.name {
+	case "add", "replace", "test":
+		value, ok := raw["value"]
+		if !ok {
+			return op, fmt.Errorf("%w: missing \"value\" member", ErrInvalidPatch)
+		}
+		v, err := decode(value)
+		if err != nil {
+			return op, fmt.Errorf("%w: %s", ErrInvalidPatch, err)
+		}
+		op.value, op.hasValue = v, true
+	case "move", "copy":
+		if err := unmarshalString(raw, "from", &op.from); err != nil {
+			return op, err
+		}
+	case "remove":
+	default:
+		return op, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.name)
+	}
+
+	return op, nil
+}
+
+func unmarshalString(raw map[string]json.RawMessage, key string, dst *string) error {
+	value, ok := raw[key]
+	if !ok {
+		return fmt.Errorf("%w: missing %q member", ErrInvalidPatch, key)
+	}
+	if err := json.Unmarshal(value, dst); err != nil {
+		return fmt.Errorf("%w: %q member must be a string", ErrInvalidPatch, key)
+	}
+	return nil
+}
+
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	path, err := parsePointer(op.path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.name {
+	case "add":
+		return add(doc, path, op.value)
+
+	case "remove":
+		doc, _, err = remove(doc, path)
+		return doc, err
+
+	case "replace":
+		if _, err := get(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return op.value, nil
+		}
+		doc, _, err = remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, op.value)
+
+	case "move":
+		from, err := parsePointer(op.from)
+		if err != nil {
+			return nil, err
+		}
+		if op.path != op.from && strings.HasPrefix(op.path, op.from+"/") {
+			return nil, fmt.Errorf("%w: cannot move a value into one of its children", ErrInvalidPatch)
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+
+	case "copy":
+		from, err := parsePointer(op.from)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, deepCopy(value))
+
+	case "test":
+		value, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(value, op.value) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.name)
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference
+// tokens. The empty pointer refers to the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q is not a valid JSON pointer", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array reference token. end allows the "-" token and
+// the index one past the last element, both meaning "append".
+func arrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("%w: %q is not a valid array index", ErrPathNotFound, token)
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a valid array index", ErrPathNotFound, token)
+	}
+
+	max := length - 1
+	if end {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrPathNotFound, i)
+	}
+	return i, nil
+}
+
+func get(node interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: member %q does not exist", ErrPathNotFound, token)
+			}
+			node = child
+		case []interface{}:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("%w: cannot descend into a scalar at %q", ErrPathNotFound, token)
+		}
+	}
+	return node, nil
+}
+
+func add(node interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: member %q does not exist", ErrPathNotFound, token)
+		}
+		child, err := add(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = child
+		return n, nil
+
+	case []interface{}:
+		if len(rest) == 0 {
+			i, err := arrayIndex(token, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := add(n[i], rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("%w: cannot descend into a scalar at %q", ErrPathNotFound, token)
+}
+
+func remove(node interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	token, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: member %q does not exist", ErrPathNotFound, token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		child, removed, err := remove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = child
+		return n, removed, nil
+
+	case []interface{}:
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		child, removed, err := remove(n[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = child
+		return n, removed, nil
+	}
+
+	return nil, nil, fmt.Errorf("%w: cannot descend into a scalar at %q", ErrPathNotFound, token)
+}
+
+// equal compares two decoded JSON values as RFC 6902 requires for the test
+// operation: numbers by value, objects regardless of member order.
+func equal(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, _, errX := big.ParseFloat(string(x), 10, 256, big.ToNearestEven)
+		fy, _, errY := big.ParseFloat(string(y), 10, 256, big.ToNearestEven)
+		if errX != nil || errY != nil {
+			return x == y
+		}
+		return fx.Cmp(fy) == 0
+	default:
+		return a == b
+	}
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			c[key] = deepCopy(child)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, child := range v {
+			c[i] = deepCopy(child)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+func decode(js []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("must only contain a single JSON value")
+	}
+	return v, nil
+}
@@ -0,0 +1,360 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual reports whether a and b hold the same JSON value, ignoring
+// formatting and key order.
+func jsonEqual(t *testing.T, a, b []byte) bool {
+	t.Helper()
+
+	var x, y interface{}
+	if err := json.Unmarshal(a, &x); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// errAny marks a case that must fail without caring which error it returns.
+var errAny = errors.New("any error")
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+		err   error
+	}{
+		// RFC 6902, Appendix A.
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "A.13 invalid JSON patch document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+			err:   errAny,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+
+		// Pointers.
+		{
+			name:  "~1 unescapes to a slash",
+			doc:   `{"a/b": 1}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 2}]`,
+			want:  `{"a/b": 2}`,
+		},
+		{
+			name:  "empty pointer replaces the document",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "", "value": [1, 2]}]`,
+			want:  `[1, 2]`,
+		},
+		{
+			name:  "pointer without leading slash",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "remove", "path": "a"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "empty member name",
+			doc:   `{"": 1}`,
+			patch: `[{"op": "test", "path": "/", "value": 1}]`,
+			want:  `{"": 1}`,
+		},
+
+		// Array indexes.
+		{
+			name:  "add at index equal to length appends",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "add", "path": "/2", "value": 3}]`,
+			want:  `[1, 2, 3]`,
+		},
+		{
+			name:  "add past the end",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "add", "path": "/3", "value": 3}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "remove at index equal to length",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "remove", "path": "/2"}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "remove with the - token",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "remove", "path": "/-"}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "index with a leading zero",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "remove", "path": "/01"}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "negative index",
+			doc:   `[1, 2]`,
+			patch: `[{"op": "remove", "path": "/-1"}]`,
+			err:   ErrPathNotFound,
+		},
+
+		// Operations.
+		{
+			name:  "remove a missing member",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "remove", "path": "/b"}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "replace a missing member",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "replace", "path": "/b", "value": 2}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "move into one of its own children",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/a/c"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "move onto itself",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/a"}]`,
+			want:  `{"a": {"b": 1}}`,
+		},
+		{
+			name:  "move to a sibling sharing a prefix",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "move", "from": "/a", "path": "/ab"}]`,
+			want:  `{"ab": 1}`,
+		},
+		{
+			name:  "copy is deep",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "add", "path": "/c/d", "value": 2}]`,
+			want:  `{"a": {"b": 1}, "c": {"b": 1, "d": 2}}`,
+		},
+		{
+			name:  "test numbers by value",
+			doc:   `{"a": 1, "b": [1e2, {"c": 0.50}]}`,
+			patch: `[{"op": "test", "path": "/a", "value": 1.0}, {"op": "test", "path": "/b", "value": [100, {"c": 0.5}]}]`,
+			want:  `{"a": 1, "b": [100, {"c": 0.5}]}`,
+		},
+		{
+			name:  "test null against a missing value",
+			doc:   `{"a": null}`,
+			patch: `[{"op": "test", "path": "/b", "value": null}]`,
+			err:   ErrPathNotFound,
+		},
+		{
+			name:  "test objects with different members",
+			doc:   `{"a": {"b": 1}}`,
+			patch: `[{"op": "test", "path": "/a", "value": {"b": 1, "c": 2}}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "a failing operation discards earlier ones",
+			doc:   `{"a": 1}`,
+			patch: `[{"op": "add", "path": "/b", "value": 2}, {"op": "test", "path": "/a", "value": 2}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "unknown operation",
+			doc:   `{}`,
+			patch: `[{"op": "merge", "path": "/a", "value": 1}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "add without a value",
+			doc:   `{}`,
+			patch: `[{"op": "add", "path": "/a"}]`,
+			err:   ErrInvalidPatch,
+		},
+		{
+			name:  "patch that is not an array",
+			doc:   `{}`,
+			patch: `{"op": "add", "path": "/a", "value": 1}`,
+			err:   ErrInvalidPatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+
+			switch {
+			case tt.err == errAny:
+				if err == nil {
+					t.Fatalf("got %s, want an error", got)
+				}
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !jsonEqual(t, got, []byte(tt.want)):
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOperationError(t *testing.T) {
+	_, err := Apply([]byte(`{"a": 1}`), []byte(`[{"op": "test", "path": "/a", "value": 1}, {"op": "remove", "path": "/b"}]`))
+
+	var opErr *OperationError
+	if !errors.As(err, &opErr) {
+		t.Fatalf("got %v, want an *OperationError", err)
+	}
+	if opErr.Index != 1 || opErr.Op != "remove" || opErr.Path != "/b" {
+		t.Fatalf("got %+v, want operation 1 (remove /b)", opErr)
+	}
+}
+
+// TestMergePatch runs the examples of RFC 7396, Appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.doc+" + "+tt.patch, func(t *testing.T) {
+			got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !jsonEqual(t, got, []byte(tt.want)) {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	_, err := MergePatch([]byte(`{}`), []byte(`{"a":`))
+	if !errors.Is(err, ErrInvalidPatch) {
+		t.Fatalf("got %v, want %v", err, ErrInvalidPatch)
+	}
+
+	_, err = MergePatch([]byte(`{} {}`), []byte(`{}`))
+	if err == nil {
+		t.Fatal("got no error for a document holding two values")
+	}
+}
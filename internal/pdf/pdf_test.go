@@ -0,0 +1,134 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestWriteTo(t *testing.T) {
+	doc := New("Certificate (draft)")
+	doc.Created = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	first := doc.AddPage()
+	first.Text(56, 780, Bold, 20, "Calibration certificate")
+	first.Line(56, 770, 539, 770, 1)
+	first.Rect(56, 700, 483, 30, 0.92)
+
+	second := doc.AddPage()
+	second.Text(56, 780, Regular, 10, `Notes (see \ above)`)
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if n != int64(len(out)) {
+		t.Fatalf("WriteTo reported %d bytes, wrote %d", n, len(out))
+	}
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) {
+		t.Fatalf("missing PDF header: %q", out[:16])
+	}
+	if !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("missing end-of-file marker")
+	}
+
+	// startxref must give the offset of the cross-reference table.
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(out)
+	if match == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if !bytes.HasPrefix(out[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	// Every entry of the table must give the offset of its object.
+	var start, count int
+	_, err = fmt.Sscanf(string(out[xref:]), "xref\n%d %d\n", &start, &count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Catalog, page tree, two fonts, two objects per page and the info.
+	if start != 0 || count != 1+2+2+2*2+1 {
+		t.Fatalf("got xref subsection %d %d", start, count)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) (\d{5}) ([nf]) \n`).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != count {
+		t.Fatalf("got %d xref entries, want %d", len(entries), count)
+	}
+	if string(entries[0][3]) != "f" {
+		t.Fatal("the first xref entry must be free")
+	}
+	for i, entry := range entries[1:] {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		want := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", i+1, out[offset:offset+len(want)], want)
+		}
+	}
+
+	if !regexp.MustCompile(`trailer\n<< /Size 10 /Root 1 0 R /Info 9 0 R >>`).Match(out) {
+		t.Error("trailer does not match the objects written")
+	}
+	if !bytes.Contains(out, []byte("/Kids [5 0 R 7 0 R] /Count 2")) {
+		t.Error("page tree does not list both pages")
+	}
+
+	// Stream lengths must match their content.
+	for _, m := range regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*?)endstream`).FindAllSubmatch(out, -1) {
+		length, _ := strconv.Atoi(string(m[1]))
+		if length != len(m[2]) {
+			t.Errorf("stream /Length %d, content is %d bytes", length, len(m[2]))
+		}
+	}
+
+	if !bytes.Contains(out, []byte(`(Notes \(see \\ above\)) Tj`)) {
+		t.Error("text is not escaped in the content stream")
+	}
+	if !bytes.Contains(out, []byte(`/Title (Certificate \(draft\))`)) {
+		t.Error("title is not escaped in the info dictionary")
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", "plain"},
+		{"(a)", `\(a\)`},
+		{`back\slash`, `back\\slash`},
+		{"two\nlines\ttab\r", "two lines tab "},
+		{"café", "caf\xe9"},
+		{"20 €", "20 \x80"},
+		{"±0.5 g", "\xb10.5 g"},
+		{"“quoted”", "\x93quoted\x94"},
+		{"check ✓", "check ?"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.in); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	if got := Width(Regular, 10, "Hi"); got != (722+222)*10/1000.0 {
+		t.Errorf("Width(Regular) = %v", got)
+	}
+	if got := Width(Bold, 10, "Hi"); got != (722+278)*10/1000.0 {
+		t.Errorf("Width(Bold) = %v", got)
+	}
+	if Width(Regular, 10, "€") != Width(Regular, 10, "é") {
+		t.Error("characters outside ASCII should share the default width")
+	}
+}
@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Flags of the Weight Measurement characteristic (0x2A9D).
+const (
+	bleFlagImperial  = 1 << 0
+	bleFlagTimestamp = 1 << 1
+	bleFlagUserID    = 1 << 2
+	bleFlagBMI       = 1 << 3
+)
+
+// Field resolutions of the Weight Measurement characteristic. Weights are
+// sent in steps of 5 g or 0.01 lb whatever the scale's own resolution, which
+// the Weight Scale Feature characteristic reports.
+const (
+	bleWeightStepSI       = 0.005 // kg
+	bleWeightStepImperial = 0.01  // lb
+	bleBMIStep            = 0.1
+	bleHeightStepSI       = 0.001   // m
+	bleHeightStepImperial = 0.00254 // m, a tenth of an inch
+)
+
+const (
+	bleWeightUnsuccessful = 0xFFFF
+	bleUserUnknown        = 0xFF
+)
+
+// DecodeWeightMeasurement decodes the value of a Bluetooth Weight Measurement
+// characteristic (0x2A9D). Scales indicate a measurement only once it is
+// final, so the result is always stable.
+//
+// The time stamp carries no zone and is taken as UTC, which is what gateways
+// set scale clocks to; a time stamp with unknown fields is left out. Bytes
+// after the fields announced by the flags are ignored, as the specification
+// asks of receivers so that fields can be added later.
+func DecodeWeightMeasurement(payload []byte) (*Measurement, error) {
+	if len(payload) < 3 {
+		return nil, fmt.Errorf("%w: weight measurement must be at least 3 bytes, got %d", ErrMalformed, len(payload))
+	}
+
+	flags := payload[0]
+	want := 3
+	if flags&bleFlagTimestamp != 0 {
+		want += 7
+	}
+	if flags&bleFlagUserID != 0 {
+		want++
+	}
+	if flags&bleFlagBMI != 0 {
+		want += 4
+	}
+	if len(payload) < want {
+		return nil, fmt.Errorf("%w: weight measurement with flags %#02x must be at least %d bytes, got %d", ErrMalformed, flags, want, len(payload))
+	}
+
+	raw := binary.LittleEndian.Uint16(payload[1:3])
+	if raw == bleWeightUnsuccessful {
+		return nil, fmt.Errorf("%w: measurement unsuccessful", ErrNoWeight)
+	}
+
+	imperial := flags&bleFlagImperial != 0
+
+	var m *Measurement
+	if imperial {
+		m = newMeasurement(roundSignificant(float64(raw)*bleWeightStepImperial, 12), Pounds, bleWeightStepImperial)
+	} else {
+		m = newMeasurement(roundSignificant(float64(raw)*bleWeightStepSI, 12), Kilograms, bleWeightStepSI)
+	}
+	m.Stable = true
+
+	rest := payload[3:]
+
+	if flags&bleFlagTimestamp != 0 {
+		m.Timestamp = decodeDateTime(rest[:7])
+		rest = rest[7:]
+	}
+
+	if flags&bleFlagUserID != 0 {
+		if rest[0] != bleUserUnknown {
+			id := int(rest[0])
+			m.UserID = &id
+		}
+		rest = rest[1:]
+	}
+
+	if flags&bleFlagBMI != 0 {
+		bmi := roundSignificant(float64(binary.LittleEndian.Uint16(rest[0:2]))*bleBMIStep, 12)
+		m.BMI = &bmi
+
+		step := bleHeightStepSI
+		if imperial {
+			step = bleHeightStepImperial
+		}
+		height := roundSignificant(float64(binary.LittleEndian.Uint16(rest[2:4]))*step, 12)
+		m.HeightMetres = &height
+	}
+
+	return m, nil
+}
+
+// decodeDateTime decodes a Date Time field: the year as a little-endian
+// uint16, then month, day, hours, minutes and seconds. It returns nil when
+// the year, month or day is zero, meaning unknown, or any field is out of
+// range.
+func decodeDateTime(b []byte) *time.Time {
+	year := int(binary.LittleEndian.Uint16(b[0:2]))
+	month, day := int(b[2]), int(b[3])
+	hour, minute, second := int(b[4]), int(b[5]), int(b[6])
+
+	if year < 1582 || year > 9999 || month < 1 || month > 12 || day < 1 || hour > 23 || minute > 59 || second > 59 {
+		return nil
+	}
+
+	t := time.Date(year, time.Month(month), day, hour, minute, second, 0, time.UTC)
+	if t.Day() != day {
+		return nil
+	}
+	return &t
+}
+
+// WeightScaleFeature is the value of the Weight Scale Feature characteristic
+// (0x2A9E), which tells what a scale's measurements contain and how precise
+// they are.
+type WeightScaleFeature struct {
+	TimestampSupported     bool
+	MultipleUsersSupported bool
+	BMISupported           bool
+
+	// WeightResolution and HeightResolution index the resolution tables of
+	// the specification. Zero means the resolution is not specified.
+	WeightResolution int
+	HeightResolution int
+}
+
+// Weight resolutions of the Weight Scale Feature characteristic, in kg and lb,
+// indexed by its weight resolution field.
+var (
+	bleWeightResolutionsSI       = []float64{0, 0.5, 0.2, 0.1, 0.05, 0.02, 0.01, 0.005}
+	bleWeightResolutionsImperial = []float64{0, 1, 0.5, 0.2, 0.1, 0.05, 0.02, 0.01}
+)
+
+// Height resolutions in metres, the imperial ones being 1, 0.5 and 0.1 inch.
+var (
+	bleHeightResolutionsSI       = []float64{0, 0.01, 0.005, 0.001}
+	bleHeightResolutionsImperial = []float64{0, 0.0254, 0.0127, 0.00254}
+)
+
+// DecodeWeightScaleFeature decodes the value of a Bluetooth Weight Scale
+// Feature characteristic (0x2A9E). Resolutions the specification reserves are
+// reported as not specified.
+func DecodeWeightScaleFeature(payload []byte) (WeightScaleFeature, error) {
+	if len(payload) < 4 {
+		return WeightScaleFeature{}, fmt.Errorf("%w: weight scale feature must be 4 bytes, got %d", ErrMalformed, len(payload))
+	}
+
+	bits := binary.LittleEndian.Uint32(payload[0:4])
+
+	f := WeightScaleFeature{
+		TimestampSupported:     bits&(1<<0) != 0,
+		MultipleUsersSupported: bits&(1<<1) != 0,
+		BMISupported:           bits&(1<<2) != 0,
+		WeightResolution:       int(bits >> 3 & 0xF),
+		HeightResolution:       int(bits >> 7 & 0x7),
+	}
+
+	if f.WeightResolution >= len(bleWeightResolutionsSI) {
+		f.WeightResolution = 0
+	}
+	if f.HeightResolution >= len(bleHeightResolutionsSI) {
+		f.HeightResolution = 0
+	}
+	return f, nil
+}
+
+// Apply sets the measurement's resolution to the one the scale reports, when
+// it reports one. Weight Measurement values only have the precision of the
+// field they are sent in, which is usually finer than the scale's.
+func (f WeightScaleFeature) Apply(m *Measurement) {
+	if f.WeightResolution == 0 {
+		return
+	}
+
+	switch m.Unit {
+	case Pounds:
+		m.Resolution = roundSignificant(Pounds.Grams(bleWeightResolutionsImperial[f.WeightResolution]), 12)
+	case Kilograms:
+		m.Resolution = roundSignificant(Kilograms.Grams(bleWeightResolutionsSI[f.WeightResolution]), 12)
+	}
+}
+
+// HeightResolutionMetres returns the height resolution in metres for imperial
+// or SI measurements, or zero when it is not specified.
+func (f WeightScaleFeature) HeightResolutionMetres(imperial bool) float64 {
+	if imperial {
+		return bleHeightResolutionsImperial[f.HeightResolution]
+	}
+	return bleHeightResolutionsSI[f.HeightResolution]
+}
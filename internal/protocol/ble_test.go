@@ -0,0 +1,276 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDecodeWeightMeasurement(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    want
+		err     error
+	}{
+		{
+			name:    "SI weight only",
+			payload: "00 b0 36", // 14000 x 5 g
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "imperial weight only",
+			payload: "01 46 3c", // 15430 x 0.01 lb
+			want:    want{value: 154.3, unit: Pounds, grams: 69989.302691, resolution: 4.5359237, stable: true},
+		},
+		{
+			name:    "zero weight",
+			payload: "00 00 00",
+			want:    want{value: 0, unit: Kilograms, grams: 0, resolution: 5, stable: true},
+		},
+		{
+			name:    "largest weight",
+			payload: "00 fe ff",
+			want:    want{value: 327.67, unit: Kilograms, grams: 327670, resolution: 5, stable: true},
+		},
+		{
+			name:    "time stamp",
+			payload: "02 b0 36 e7 07 05 11 08 1e 0f",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true, timestamp: date(2023, 5, 17, 8, 30, 15)},
+		},
+		{
+			name:    "time stamp with unknown year",
+			payload: "02 b0 36 00 00 05 11 08 1e 0f",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "time stamp with unknown month and day",
+			payload: "02 b0 36 e7 07 00 00 08 1e 0f",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "time stamp on a day the month does not have",
+			payload: "02 b0 36 e7 07 02 1e 08 1e 0f",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "time stamp with hour out of range",
+			payload: "02 b0 36 e7 07 05 11 18 1e 0f",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "user",
+			payload: "04 b0 36 03",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true, userID: ptr(3)},
+		},
+		{
+			name:    "unknown user",
+			payload: "04 b0 36 ff",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "SI BMI and height",
+			payload: "08 b0 36 e5 00 d4 06", // 22.9, 1.748 m
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true, bmi: ptr(22.9), height: ptr(1.748)},
+		},
+		{
+			name:    "imperial BMI and height",
+			payload: "09 46 3c e5 00 b0 02", // 22.9, 68.8 in
+			want:    want{value: 154.3, unit: Pounds, grams: 69989.302691, resolution: 4.5359237, stable: true, bmi: ptr(22.9), height: ptr(1.74752)},
+		},
+		{
+			name:    "every field",
+			payload: "0e b0 36 e8 07 02 1d 17 3b 3b 01 e5 00 d4 06",
+			want: want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true,
+				timestamp: date(2024, 2, 29, 23, 59, 59), userID: ptr(1), bmi: ptr(22.9), height: ptr(1.748)},
+		},
+		{
+			name:    "trailing bytes are ignored",
+			payload: "00 b0 36 aa bb",
+			want:    want{value: 70, unit: Kilograms, grams: 70000, resolution: 5, stable: true},
+		},
+		{
+			name:    "measurement unsuccessful",
+			payload: "00 ff ff",
+			err:     ErrNoWeight,
+		},
+		{
+			name:    "measurement unsuccessful with other fields",
+			payload: "06 ff ff e7 07 05 11 08 1e 0f 01",
+			err:     ErrNoWeight,
+		},
+		{
+			name:    "empty",
+			payload: "",
+			err:     ErrMalformed,
+		},
+		{
+			name:    "truncated weight",
+			payload: "00 b0",
+			err:     ErrMalformed,
+		},
+		{
+			name:    "truncated time stamp",
+			payload: "02 b0 36 e7 07 05",
+			err:     ErrMalformed,
+		},
+		{
+			name:    "missing user",
+			payload: "04 b0 36",
+			err:     ErrMalformed,
+		},
+		{
+			name:    "truncated height",
+			payload: "08 b0 36 e5 00 d4",
+			err:     ErrMalformed,
+		},
+		{
+			name:    "every flag but too short for the last field",
+			payload: "0e b0 36 e8 07 02 1d 17 3b 3b 01 e5 00",
+			err:     ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := DecodeWeightMeasurement(payload(t, tt.payload))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %+v, %v, want error %v", m, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkMeasurement(t, m, tt.want)
+		})
+	}
+}
+
+func TestDecodeWeightScaleFeature(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    WeightScaleFeature
+		err     error
+	}{
+		{
+			name:    "nothing supported",
+			payload: "00 00 00 00",
+			want:    WeightScaleFeature{},
+		},
+		{
+			name:    "every feature at the finest resolutions",
+			payload: "bf 01 00 00",
+			want: WeightScaleFeature{TimestampSupported: true, MultipleUsersSupported: true, BMISupported: true,
+				WeightResolution: 7, HeightResolution: 3},
+		},
+		{
+			name:    "time stamp and 0.5 kg",
+			payload: "09 00 00 00",
+			want:    WeightScaleFeature{TimestampSupported: true, WeightResolution: 1},
+		},
+		{
+			name:    "multiple users, 0.05 kg and 1 cm",
+			payload: "a2 00 00 00",
+			want:    WeightScaleFeature{MultipleUsersSupported: true, WeightResolution: 4, HeightResolution: 1},
+		},
+		{
+			name:    "reserved weight resolution",
+			payload: "40 00 00 00",
+			want:    WeightScaleFeature{},
+		},
+		{
+			name:    "reserved height resolution",
+			payload: "00 02 00 00",
+			want:    WeightScaleFeature{},
+		},
+		{
+			name:    "reserved bits are ignored",
+			payload: "04 fc ff ff",
+			want:    WeightScaleFeature{BMISupported: true, HeightResolution: 0},
+		},
+		{
+			name:    "truncated",
+			payload: "bf 01",
+			err:     ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeWeightScaleFeature(payload(t, tt.payload))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %+v, %v, want error %v", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWeightScaleFeatureResolutions(t *testing.T) {
+	weights := []struct {
+		index    int
+		si       float64 // g
+		imperial float64 // g
+	}{
+		{1, 500, 453.59237},
+		{2, 200, 226.796185},
+		{3, 100, 90.718474},
+		{4, 50, 45.359237},
+		{5, 20, 22.6796185},
+		{6, 10, 9.0718474},
+		{7, 5, 4.5359237},
+	}
+
+	for _, w := range weights {
+		f := WeightScaleFeature{WeightResolution: w.index}
+
+		m := &Measurement{Unit: Kilograms, Resolution: 5}
+		f.Apply(m)
+		if !closeTo(m.Resolution, w.si) {
+			t.Errorf("weight resolution %d in kg: got %v g, want %v g", w.index, m.Resolution, w.si)
+		}
+
+		m = &Measurement{Unit: Pounds, Resolution: 4.5359237}
+		f.Apply(m)
+		if !closeTo(m.Resolution, w.imperial) {
+			t.Errorf("weight resolution %d in lb: got %v g, want %v g", w.index, m.Resolution, w.imperial)
+		}
+	}
+
+	m := &Measurement{Unit: Kilograms, Resolution: 5}
+	WeightScaleFeature{}.Apply(m)
+	if m.Resolution != 5 {
+		t.Errorf("unspecified resolution changed the measurement to %v g", m.Resolution)
+	}
+
+	heights := []struct {
+		index    int
+		si       float64
+		imperial float64
+	}{
+		{0, 0, 0},
+		{1, 0.01, 0.0254},
+		{2, 0.005, 0.0127},
+		{3, 0.001, 0.00254},
+	}
+
+	for _, h := range heights {
+		f := WeightScaleFeature{HeightResolution: h.index}
+		if got := f.HeightResolutionMetres(false); got != h.si {
+			t.Errorf("height resolution %d in SI: got %v, want %v", h.index, got, h.si)
+		}
+		if got := f.HeightResolutionMetres(true); got != h.imperial {
+			t.Errorf("height resolution %d in imperial: got %v, want %v", h.index, got, h.imperial)
+		}
+	}
+}
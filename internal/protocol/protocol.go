@@ -0,0 +1,139 @@
+// Package protocol decodes the payloads sent by connected scales: the
+// Bluetooth Weight Measurement characteristic and the ASCII frames common on
+// serial and USB scales. Each payload decodes to a Measurement, which becomes
+// a reading for ingestion.
+package protocol
+
+import (
+	"awesomeProject3/internal/data"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Payload formats accepted by Decode.
+const (
+	FormatBLEWeight = "ble-weight"
+	FormatSerial    = "serial"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown payload format")
+	ErrMalformed     = errors.New("malformed payload")
+	ErrUnknownUnit   = errors.New("unknown weight unit")
+
+	// ErrNoWeight is returned for well-formed payloads that report a state
+	// instead of a weight, such as an overload or a scale still starting up.
+	ErrNoWeight = errors.New("payload carries no weight")
+)
+
+// Unit is a unit of weight as it is written in serial frames.
+type Unit string
+
+const (
+	Milligrams Unit = "mg"
+	Grams      Unit = "g"
+	Kilograms  Unit = "kg"
+	Carats     Unit = "ct"
+	Ounces     Unit = "oz"
+	Pounds     Unit = "lb"
+)
+
+var unitGrams = map[Unit]float64{
+	Milligrams: 0.001,
+	Grams:      1,
+	Kilograms:  1000,
+	Carats:     0.2,
+	Ounces:     28.349523125,
+	Pounds:     453.59237,
+}
+
+// ParseUnit returns the unit written as s, ignoring case.
+func ParseUnit(s string) (Unit, error) {
+	s = strings.ToLower(s)
+	if s == "lbs" {
+		s = "lb"
+	}
+	if _, ok := unitGrams[Unit(s)]; !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownUnit, s)
+	}
+	return Unit(s), nil
+}
+
+// Grams converts value in the unit to grams.
+func (u Unit) Grams(value float64) float64 {
+	return value * unitGrams[u]
+}
+
+// Imperial reports whether the unit is an avoirdupois one.
+func (u Unit) Imperial() bool {
+	return u == Ounces || u == Pounds
+}
+
+// Measurement is a decoded weight. Value is the weight in the unit the scale
+// sent it in and Grams the same weight in grams. Resolution is the smallest
+// step the payload can express, in grams, or zero when it is not known.
+// Timestamp is set only when the payload carries the time of measurement.
+type Measurement struct {
+	Value      float64
+	Unit       Unit
+	Grams      float64
+	Resolution float64
+	Stable     bool
+	Timestamp  *time.Time
+
+	// Set only by the Bluetooth Weight Measurement characteristic, when the
+	// scale includes them.
+	UserID       *int
+	BMI          *float64
+	HeightMetres *float64
+}
+
+func newMeasurement(value float64, unit Unit, step float64) *Measurement {
+	return &Measurement{
+		Value:      value,
+		Unit:       unit,
+		Grams:      roundSignificant(unit.Grams(value), 12),
+		Resolution: roundSignificant(unit.Grams(step), 12),
+	}
+}
+
+// roundSignificant rounds x to the given number of significant digits. Unit
+// conversions are exact in decimal, so this only drops the error of binary
+// floating point, which would otherwise turn 1.234 kg into 1234.0000000000002 g.
+func roundSignificant(x float64, digits int) float64 {
+	if x == 0 || math.IsNaN(x) || math.IsInf(x, 0) {
+		return x
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(x, 'g', digits, 64), 64)
+	return rounded
+}
+
+// Reading returns the measurement as a reading for ingestion. Measurements
+// without a timestamp of their own are taken to have been made at receivedAt.
+func (m *Measurement) Reading(receivedAt time.Time) data.Reading {
+	reading := data.Reading{
+		RecordedAt: receivedAt,
+		Grams:      m.Grams,
+		Stable:     m.Stable,
+	}
+	if m.Timestamp != nil {
+		reading.RecordedAt = *m.Timestamp
+	}
+	return reading
+}
+
+// Decode decodes a payload in the given format.
+func Decode(format string, payload []byte) (*Measurement, error) {
+	switch format {
+	case FormatBLEWeight:
+		return DecodeWeightMeasurement(payload)
+	case FormatSerial:
+		return DecodeSerialFrame(payload)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// payload decodes bytes written in hex, as they appear in a packet capture,
+// with spaces between them.
+func payload(t *testing.T, s string) []byte {
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatalf("bad hex %q: %v", s, err)
+	}
+	return b
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(1, math.Abs(b))
+}
+
+// want is the part of a Measurement a test case checks. Nil pointers must be
+// nil in the measurement too.
+type want struct {
+	value      float64
+	unit       Unit
+	grams      float64
+	resolution float64
+	stable     bool
+	timestamp  *time.Time
+	userID     *int
+	bmi        *float64
+	height     *float64
+}
+
+func checkMeasurement(t *testing.T, m *Measurement, w want) {
+	t.Helper()
+
+	if !closeTo(m.Value, w.value) || m.Unit != w.unit {
+		t.Errorf("got %v %s, want %v %s", m.Value, m.Unit, w.value, w.unit)
+	}
+	if !closeTo(m.Grams, w.grams) {
+		t.Errorf("got %v g, want %v g", m.Grams, w.grams)
+	}
+	if !closeTo(m.Resolution, w.resolution) {
+		t.Errorf("got resolution %v g, want %v g", m.Resolution, w.resolution)
+	}
+	if m.Stable != w.stable {
+		t.Errorf("got stable %v, want %v", m.Stable, w.stable)
+	}
+
+	switch {
+	case (m.Timestamp == nil) != (w.timestamp == nil):
+		t.Errorf("got timestamp %v, want %v", m.Timestamp, w.timestamp)
+	case m.Timestamp != nil && !m.Timestamp.Equal(*w.timestamp):
+		t.Errorf("got timestamp %v, want %v", *m.Timestamp, *w.timestamp)
+	}
+
+	switch {
+	case (m.UserID == nil) != (w.userID == nil):
+		t.Errorf("got user %v, want %v", m.UserID, w.userID)
+	case m.UserID != nil && *m.UserID != *w.userID:
+		t.Errorf("got user %d, want %d", *m.UserID, *w.userID)
+	}
+
+	for _, f := range []struct {
+		name      string
+		got, want *float64
+	}{
+		{"bmi", m.BMI, w.bmi},
+		{"height", m.HeightMetres, w.height},
+	} {
+		switch {
+		case (f.got == nil) != (f.want == nil):
+			t.Errorf("got %s %v, want %v", f.name, f.got, f.want)
+		case f.got != nil && !closeTo(*f.got, *f.want):
+			t.Errorf("got %s %v, want %v", f.name, *f.got, *f.want)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func date(year int, month time.Month, day, hour, min, sec int) *time.Time {
+	return ptr(time.Date(year, month, day, hour, min, sec, 0, time.UTC))
+}
+
+func TestDecode(t *testing.T) {
+	m, err := Decode(FormatBLEWeight, payload(t, "00 b0 36"))
+	if err != nil || m.Unit != Kilograms {
+		t.Errorf("ble-weight: got %+v, %v", m, err)
+	}
+
+	m, err = Decode(FormatSerial, []byte("ST,+00123.45  g\r\n"))
+	if err != nil || m.Unit != Grams {
+		t.Errorf("serial: got %+v, %v", m, err)
+	}
+
+	_, err = Decode("modbus", []byte{1})
+	if !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("unknown format: got %v, want %v", err, ErrUnknownFormat)
+	}
+}
+
+func TestReading(t *testing.T) {
+	receivedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	m := &Measurement{Grams: 250, Stable: true}
+	r := m.Reading(receivedAt)
+	if !r.RecordedAt.Equal(receivedAt) || r.Grams != 250 || !r.Stable {
+		t.Errorf("without timestamp: got %+v", r)
+	}
+
+	m.Timestamp = date(2023, 12, 31, 23, 59, 0)
+	r = m.Reading(receivedAt)
+	if !r.RecordedAt.Equal(*m.Timestamp) {
+		t.Errorf("with timestamp: got %v, want %v", r.RecordedAt, *m.Timestamp)
+	}
+}
+
+func TestParseUnit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Unit
+		err  error
+	}{
+		{"g", Grams, nil},
+		{"KG", Kilograms, nil},
+		{"lbs", Pounds, nil},
+		{"LB", Pounds, nil},
+		{"oz", Ounces, nil},
+		{"ct", Carats, nil},
+		{"mg", Milligrams, nil},
+		{"stone", "", ErrUnknownUnit},
+		{"", "", ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUnit(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("ParseUnit(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
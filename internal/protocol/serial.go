@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DecodeSerialFrame decodes one line of output from a serial or USB scale.
+// Three layouts cover most kitchen and bench scales:
+//
+//	ST,+00123.45  g      A&D style: ST stable, US unstable, OL overload,
+//	ST,NT,+  1.234kg     optionally followed by GS gross or NT net
+//	S S     123.45 g     MT-SICS: S stable, D dynamic, I busy, + and - out of range
+//	    123.45 g  ?      plain print output, with ? marking an unstable weight
+//
+// Surrounding whitespace, line endings and STX/ETX framing bytes are ignored.
+// The resolution is one step in the last decimal place sent.
+func DecodeSerialFrame(frame []byte) (*Measurement, error) {
+	line := strings.Trim(string(frame), " \t\r\n\x02\x03")
+	if line == "" {
+		return nil, fmt.Errorf("%w: empty frame", ErrMalformed)
+	}
+
+	switch {
+	case strings.HasPrefix(line, "S ") || line == "S":
+		return decodeSICSFrame(line)
+	case strings.Contains(line, ","):
+		return decodeHeaderFrame(line)
+	default:
+		return decodePlainFrame(line)
+	}
+}
+
+func decodeSICSFrame(line string) (*Measurement, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%w: SICS frame without status", ErrMalformed)
+	}
+
+	var stable bool
+	switch fields[1] {
+	case "S":
+		stable = true
+	case "D":
+		stable = false
+	case "I":
+		return nil, fmt.Errorf("%w: scale busy", ErrNoWeight)
+	case "+":
+		return nil, fmt.Errorf("%w: overload", ErrNoWeight)
+	case "-":
+		return nil, fmt.Errorf("%w: underload", ErrNoWeight)
+	default:
+		return nil, fmt.Errorf("%w: unknown SICS status %q", ErrMalformed, fields[1])
+	}
+
+	m, err := parseWeight(strings.Join(fields[2:], " "))
+	if err != nil {
+		return nil, err
+	}
+	m.Stable = stable
+	return m, nil
+}
+
+func decodeHeaderFrame(line string) (*Measurement, error) {
+	fields := strings.Split(line, ",")
+
+	var stable bool
+	switch strings.TrimSpace(fields[0]) {
+	case "ST":
+		stable = true
+	case "US":
+		stable = false
+	case "OL":
+		return nil, fmt.Errorf("%w: overload", ErrNoWeight)
+	default:
+		return nil, fmt.Errorf("%w: unknown header %q", ErrMalformed, fields[0])
+	}
+
+	value := fields[1:]
+	if len(value) == 2 {
+		switch strings.TrimSpace(value[0]) {
+		case "GS", "NT":
+			value = value[1:]
+		default:
+			return nil, fmt.Errorf("%w: unknown weight type %q", ErrMalformed, value[0])
+		}
+	}
+	if len(value) != 1 {
+		return nil, fmt.Errorf("%w: expected a header and a weight, got %d fields", ErrMalformed, len(fields))
+	}
+
+	m, err := parseWeight(value[0])
+	if err != nil {
+		return nil, err
+	}
+	m.Stable = stable
+	return m, nil
+}
+
+func decodePlainFrame(line string) (*Measurement, error) {
+	stable := true
+
+	fields := []string{}
+	for _, field := range strings.Fields(line) {
+		if field == "?" {
+			stable = false
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	// Scales may print G, N or NET after the unit for gross and net weights,
+	// but a lone G is also the unit of "12 G".
+	if n := len(fields); n > 1 {
+		switch strings.ToUpper(fields[n-1]) {
+		case "G", "N", "NET":
+			if m, err := parseWeight(strings.Join(fields[:n-1], " ")); err == nil {
+				m.Stable = stable
+				return m, nil
+			}
+		}
+	}
+
+	m, err := parseWeight(strings.Join(fields, " "))
+	if err != nil {
+		return nil, err
+	}
+	m.Stable = stable
+	return m, nil
+}
+
+// parseWeight parses a signed decimal number followed by a unit, such as
+// "+00123.45  g", "-  1.234kg" or "0.50 lb". Spaces may separate the sign
+// from the digits, as scales pad numbers to a fixed width.
+func parseWeight(s string) (*Measurement, error) {
+	s = strings.TrimSpace(s)
+
+	sign := ""
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		sign, s = s[:1], strings.TrimLeft(s[1:], " ")
+	}
+
+	end := 0
+	decimals := -1
+	for end < len(s) {
+		c := s[end]
+		if c == '.' && decimals < 0 {
+			decimals = 0
+		} else if c >= '0' && c <= '9' {
+			if decimals >= 0 {
+				decimals++
+			}
+		} else {
+			break
+		}
+		end++
+	}
+
+	number := s[:end]
+	if number == "" || number == "." {
+		return nil, fmt.Errorf("%w: no weight in %q", ErrMalformed, s)
+	}
+
+	value, err := strconv.ParseFloat(sign+number, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad weight %q", ErrMalformed, sign+number)
+	}
+	if value == 0 {
+		value = 0 // drop the sign of -0
+	}
+
+	unitText := strings.TrimSpace(s[end:])
+	if unitText == "" {
+		return nil, fmt.Errorf("%w: weight %q without a unit", ErrMalformed, sign+number)
+	}
+	unit, err := ParseUnit(unitText)
+	if err != nil {
+		return nil, err
+	}
+
+	if decimals < 0 {
+		decimals = 0
+	}
+	return newMeasurement(value, unit, math.Pow10(-decimals)), nil
+}
@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestDecodeSerialFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame string
+		want  want
+		err   error
+	}{
+		// A&D style.
+		{
+			name:  "A&D stable",
+			frame: "ST,+00123.45  g\r\n",
+			want:  want{value: 123.45, unit: Grams, grams: 123.45, resolution: 0.01, stable: true},
+		},
+		{
+			name:  "A&D unstable",
+			frame: "US,+00123.40  g\r\n",
+			want:  want{value: 123.4, unit: Grams, grams: 123.4, resolution: 0.01, stable: false},
+		},
+		{
+			name:  "A&D net with the sign apart",
+			frame: "ST,NT,+  1.234kg\r\n",
+			want:  want{value: 1.234, unit: Kilograms, grams: 1234, resolution: 1, stable: true},
+		},
+		{
+			name:  "A&D gross negative in pounds",
+			frame: "ST,GS,-0000.50 lb\r\n",
+			want:  want{value: -0.5, unit: Pounds, grams: -226.796185, resolution: 4.5359237, stable: true},
+		},
+		{
+			name:  "A&D whole grams",
+			frame: "ST,+0001250  g\r\n",
+			want:  want{value: 1250, unit: Grams, grams: 1250, resolution: 1, stable: true},
+		},
+		{
+			name:  "A&D overload",
+			frame: "OL,+99999.99  g\r\n",
+			err:   ErrNoWeight,
+		},
+		{
+			name:  "A&D unknown header",
+			frame: "QT,+00123.45  g\r\n",
+			err:   ErrMalformed,
+		},
+		{
+			name:  "A&D unknown weight type",
+			frame: "ST,TR,+00123.45  g\r\n",
+			err:   ErrMalformed,
+		},
+		{
+			name:  "A&D too many fields",
+			frame: "ST,NT,+00123.45  g,X\r\n",
+			err:   ErrMalformed,
+		},
+
+		// MT-SICS.
+		{
+			name:  "SICS stable",
+			frame: "S S     123.45 g\r\n",
+			want:  want{value: 123.45, unit: Grams, grams: 123.45, resolution: 0.01, stable: true},
+		},
+		{
+			name:  "SICS dynamic",
+			frame: "S D     123.40 g\r\n",
+			want:  want{value: 123.4, unit: Grams, grams: 123.4, resolution: 0.01, stable: false},
+		},
+		{
+			name:  "SICS negative kilograms",
+			frame: "S S    -0.0125 kg\r\n",
+			want:  want{value: -0.0125, unit: Kilograms, grams: -12.5, resolution: 0.1, stable: true},
+		},
+		{
+			name:  "SICS busy",
+			frame: "S I\r\n",
+			err:   ErrNoWeight,
+		},
+		{
+			name:  "SICS overload",
+			frame: "S +\r\n",
+			err:   ErrNoWeight,
+		},
+		{
+			name:  "SICS underload",
+			frame: "S -\r\n",
+			err:   ErrNoWeight,
+		},
+		{
+			name:  "SICS unknown status",
+			frame: "S X     123.45 g\r\n",
+			err:   ErrMalformed,
+		},
+		{
+			name:  "SICS without status",
+			frame: "S\r\n",
+			err:   ErrMalformed,
+		},
+
+		// Plain print output.
+		{
+			name:  "plain stable",
+			frame: "    123.45 g  \r\n",
+			want:  want{value: 123.45, unit: Grams, grams: 123.45, resolution: 0.01, stable: true},
+		},
+		{
+			name:  "plain unstable",
+			frame: "    123.45 g  ?\r\n",
+			want:  want{value: 123.45, unit: Grams, grams: 123.45, resolution: 0.01, stable: false},
+		},
+		{
+			name:  "plain unstable mark first",
+			frame: "?   123.45 g\r\n",
+			want:  want{value: 123.45, unit: Grams, grams: 123.45, resolution: 0.01, stable: false},
+		},
+		{
+			name:  "plain net mark",
+			frame: "  12.5 oz N\r\n",
+			want:  want{value: 12.5, unit: Ounces, grams: 354.3690390625, resolution: 2.8349523125, stable: true},
+		},
+		{
+			name:  "plain gross mark",
+			frame: "  0.75 kg G\r\n",
+			want:  want{value: 0.75, unit: Kilograms, grams: 750, resolution: 10, stable: true},
+		},
+		{
+			name:  "plain NET mark",
+			frame: "  1.5 lbs NET\r\n",
+			want:  want{value: 1.5, unit: Pounds, grams: 680.388555, resolution: 45.359237, stable: true},
+		},
+		{
+			name:  "plain upper case grams are not a mark",
+			frame: "  12 G\r\n",
+			want:  want{value: 12, unit: Grams, grams: 12, resolution: 1, stable: true},
+		},
+		{
+			name:  "plain carats",
+			frame: "  5.00 ct\r\n",
+			want:  want{value: 5, unit: Carats, grams: 1, resolution: 0.002, stable: true},
+		},
+		{
+			name:  "STX and ETX framing",
+			frame: "\x02  0.000 kg\x03",
+			want:  want{value: 0, unit: Kilograms, grams: 0, resolution: 1, stable: true},
+		},
+		{
+			name:  "plain without a unit",
+			frame: "  123.45\r\n",
+			err:   ErrMalformed,
+		},
+		{
+			name:  "plain with an unknown unit",
+			frame: "  12.3 stone\r\n",
+			err:   ErrUnknownUnit,
+		},
+		{
+			name:  "plain without a number",
+			frame: "  -- g\r\n",
+			err:   ErrMalformed,
+		},
+		{
+			name:  "only a decimal point",
+			frame: "  . g\r\n",
+			err:   ErrMalformed,
+		},
+		{
+			name:  "empty",
+			frame: "\r\n",
+			err:   ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := DecodeSerialFrame([]byte(tt.frame))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %+v, %v, want error %v", m, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkMeasurement(t, m, tt.want)
+		})
+	}
+}
+
+func TestDecodeSerialFrameNegativeZero(t *testing.T) {
+	m, err := DecodeSerialFrame([]byte("ST,-00000.00  g\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Signbit(m.Value) || math.Signbit(m.Grams) {
+		t.Errorf("got %v g, want an unsigned zero", m.Grams)
+	}
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// KeyRX is what a blob key looks like: slash-separated segments of letters,
+// digits, dots, dashes and underscores, none of them starting with a dot.
+var KeyRX = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// BlobStore keeps opaque blobs of data under string keys. Put replaces any
+// blob already stored under the key.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+func validKey(key string) bool {
+	return len(key) <= 512 && KeyRX.MatchString(key)
+}
@@ -0,0 +1,66 @@
+package validator
+
+import (
+	"strings"
+)
+
+// GTIN lengths accepted as input: UPC-A, EAN-13 and GTIN-14. Shorter codes
+// are the same number with leading zeros left out, so every valid code has a
+// single GTIN-14 form.
+const (
+	UPCALength   = 12
+	EAN13Length  = 13
+	GTIN14Length = 14
+)
+
+// GTINCheckDigit computes the check digit for the digits of a GTIN without
+// its last one. Weights of 3 and 1 alternate from the right, starting with 3.
+// It returns -1 when digits contains anything other than ASCII digits.
+func GTINCheckDigit(digits string) int {
+	sum := 0
+	for i := 0; i < len(digits); i++ {
+		c := digits[len(digits)-1-i]
+		if c < '0' || c > '9' {
+			return -1
+		}
+		d := int(c - '0')
+		if i%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+// ValidGTIN reports whether code is a UPC-A, EAN-13 or GTIN-14 with a correct
+// check digit.
+func ValidGTIN(code string) bool {
+	switch len(code) {
+	case UPCALength, EAN13Length, GTIN14Length:
+	default:
+		return false
+	}
+
+	last := code[len(code)-1]
+	if last < '0' || last > '9' {
+		return false
+	}
+	return GTINCheckDigit(code[:len(code)-1]) == int(last-'0')
+}
+
+// NormalizeGTIN returns the GTIN-14 form of a valid UPC-A, EAN-13 or GTIN-14,
+// padding it with leading zeros. Spaces and dashes, as printed under some
+// barcodes, are ignored. ok is false when the code is not valid.
+func NormalizeGTIN(code string) (gtin string, ok bool) {
+	code = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+
+	if !ValidGTIN(code) {
+		return "", false
+	}
+	return strings.Repeat("0", GTIN14Length-len(code)) + code, true
+}
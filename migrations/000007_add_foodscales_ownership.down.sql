@@ -0,0 +1,8 @@
+DELETE FROM "permissions" WHERE code = 'scales:admin' ;
+DROP TABLE IF EXISTS "foodscales_acl" ;
+ALTER TABLE "FoodScales" DROP CONSTRAINT IF EXISTS foodscales_single_owner_check ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS owner_group_id ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS owner_user_id ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS created_by ;
+DROP TABLE IF EXISTS "groups_users" ;
+DROP TABLE IF EXISTS "groups" ;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS "groups" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    name text UNIQUE NOT NULL );
+
+CREATE TABLE IF NOT EXISTS "groups_users" (
+    group_id bigint NOT NULL REFERENCES "groups" ON DELETE CASCADE ,
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    PRIMARY KEY (group_id , user_id ));
+
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES "Users" ON DELETE SET NULL ;
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS owner_user_id bigint REFERENCES "Users" ON DELETE SET NULL ;
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS owner_group_id bigint REFERENCES "groups" ON DELETE SET NULL ;
+ALTER TABLE "FoodScales" ADD CONSTRAINT foodscales_single_owner_check CHECK (owner_user_id IS NULL OR owner_group_id IS NULL);
+
+CREATE TABLE IF NOT EXISTS "foodscales_acl" (
+    id bigserial PRIMARY KEY ,
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    user_id bigint REFERENCES "Users" ON DELETE CASCADE ,
+    group_id bigint REFERENCES "groups" ON DELETE CASCADE ,
+    role text NOT NULL ,
+    CONSTRAINT foodscales_acl_role_check CHECK (role IN ('editor', 'viewer')),
+    CONSTRAINT foodscales_acl_subject_check CHECK ((user_id IS NULL) <> (group_id IS NULL)));
+
+CREATE UNIQUE INDEX IF NOT EXISTS foodscales_acl_user_idx ON "foodscales_acl" (foodscale_id, user_id) WHERE user_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS foodscales_acl_group_idx ON "foodscales_acl" (foodscale_id, group_id) WHERE group_id IS NOT NULL;
+
+INSERT INTO "permissions" (code)
+VALUES
+    ('scales:admin');
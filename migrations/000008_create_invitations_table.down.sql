@@ -0,0 +1,2 @@
+DELETE FROM "permissions" WHERE code = 'users:admin' ;
+DROP TABLE IF EXISTS "invitations" ;
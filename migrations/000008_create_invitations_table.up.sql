@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS "invitations" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    email text NOT NULL ,
+    role text NOT NULL ,
+    invited_by bigint REFERENCES "Users" ON DELETE SET NULL ,
+    token_hash bytea UNIQUE NOT NULL ,
+    expiry timestamp (0) with time zone NOT NULL ,
+    accepted_at timestamp (0) with time zone ,
+    accepted_user_id bigint REFERENCES "Users" ON DELETE SET NULL ,
+    revoked_at timestamp (0) with time zone );
+
+CREATE INDEX IF NOT EXISTS invitations_email_idx ON "invitations" (email);
+
+INSERT INTO "permissions" (code)
+VALUES
+    ('users:admin');
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS "audit_events" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    actor_id bigint ,
+    action text NOT NULL ,
+    resource_type text NOT NULL ,
+    resource_id bigint ,
+    before jsonb ,
+    after jsonb ,
+    diff jsonb ,
+    ip text NOT NULL DEFAULT '' ,
+    request_id text NOT NULL DEFAULT '' );
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON "audit_events" (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON "audit_events" (resource_type, resource_id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON "audit_events" (created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only () RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only_trigger
+    BEFORE UPDATE OR DELETE ON "audit_events"
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only ();
+
+INSERT INTO "permissions" (code)
+VALUES
+    ('audit:read');
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS foodscales_record_version_trigger ON "FoodScales" ;
+DROP FUNCTION IF EXISTS foodscales_record_version ();
+DROP TABLE IF EXISTS "foodscales_versions" ;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS "foodscales_versions" (
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    version bigint NOT NULL ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    model text NOT NULL ,
+    year integer NOT NULL ,
+    price integer NOT NULL ,
+    runtime integer NOT NULL ,
+    dimensions numeric [] NOT NULL ,
+    PRIMARY KEY (foodscale_id , version ));
+
+CREATE OR REPLACE FUNCTION foodscales_record_version () RETURNS trigger AS $$
+BEGIN
+    INSERT INTO "foodscales_versions" (foodscale_id, version, model, year, price, runtime, dimensions)
+    VALUES (NEW.id, NEW.version, NEW.model, NEW.year, NEW.price, NEW.runtime, NEW.dimensions)
+    ON CONFLICT (foodscale_id, version) DO NOTHING;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER foodscales_record_version_trigger
+    AFTER INSERT OR UPDATE OF version ON "FoodScales"
+    FOR EACH ROW EXECUTE FUNCTION foodscales_record_version ();
+
+INSERT INTO "foodscales_versions" (foodscale_id, version, model, year, price, runtime, dimensions)
+SELECT id, version, model, year, price, runtime, dimensions FROM "FoodScales"
+ON CONFLICT (foodscale_id, version) DO NOTHING;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS foodscales_deleted_at_idx ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS deleted_at ;
@@ -0,0 +1,3 @@
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS deleted_at timestamp (0) with time zone ;
+
+CREATE INDEX IF NOT EXISTS foodscales_deleted_at_idx ON "FoodScales" (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS sku text ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS foodscales_sku_idx ON "FoodScales" (sku);
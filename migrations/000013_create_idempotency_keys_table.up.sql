@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+    user_id bigint NOT NULL ,
+    key text NOT NULL ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    expires_at timestamp (0) with time zone NOT NULL ,
+    request_hash bytea NOT NULL ,
+    completed bool NOT NULL DEFAULT FALSE ,
+    status integer NOT NULL DEFAULT 0 ,
+    headers jsonb ,
+    body bytea ,
+    PRIMARY KEY (user_id , key ));
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON "idempotency_keys" (expires_at);
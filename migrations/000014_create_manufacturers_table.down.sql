@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS foodscales_manufacturer_id_idx ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS manufacturer_id ;
+DROP TABLE IF EXISTS "manufacturers" ;
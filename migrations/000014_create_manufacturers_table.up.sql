@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS "manufacturers" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    name text NOT NULL ,
+    country text NOT NULL DEFAULT '' ,
+    website text NOT NULL DEFAULT '' );
+
+CREATE UNIQUE INDEX IF NOT EXISTS manufacturers_name_idx ON "manufacturers" (lower(name));
+
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS manufacturer_id bigint REFERENCES "manufacturers" ON DELETE SET NULL ;
+
+CREATE INDEX IF NOT EXISTS foodscales_manufacturer_id_idx ON "FoodScales" (manufacturer_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS foodscales_model_trgm_idx ;
+DROP EXTENSION IF EXISTS pg_trgm ;
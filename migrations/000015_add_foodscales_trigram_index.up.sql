@@ -0,0 +1,3 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm ;
+
+CREATE INDEX IF NOT EXISTS foodscales_model_trgm_idx ON "FoodScales" USING GIN (model gin_trgm_ops);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "watchlists_items" ;
+DROP TABLE IF EXISTS "watchlists" ;
+DROP TABLE IF EXISTS "favorites" ;
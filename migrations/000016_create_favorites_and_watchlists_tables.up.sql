@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS "favorites" (
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    added_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (user_id , foodscale_id ));
+
+CREATE INDEX IF NOT EXISTS favorites_foodscale_id_idx ON "favorites" (foodscale_id);
+
+CREATE TABLE IF NOT EXISTS "watchlists" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    name text NOT NULL ,
+    share_token_hash bytea UNIQUE );
+
+CREATE UNIQUE INDEX IF NOT EXISTS watchlists_user_name_idx ON "watchlists" (user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS "watchlists_items" (
+    watchlist_id bigint NOT NULL REFERENCES "watchlists" ON DELETE CASCADE ,
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    added_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (watchlist_id , foodscale_id ));
+
+CREATE INDEX IF NOT EXISTS watchlists_items_foodscale_id_idx ON "watchlists_items" (foodscale_id);
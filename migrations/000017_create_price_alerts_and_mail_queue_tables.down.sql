@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "price_alert_settings";
+DROP TABLE IF EXISTS "price_alert_notifications";
+DROP TABLE IF EXISTS "price_alerts";
+DROP TABLE IF EXISTS "mail_queue";
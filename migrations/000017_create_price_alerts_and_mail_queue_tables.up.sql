@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS "mail_queue" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    recipient text NOT NULL ,
+    template text NOT NULL ,
+    data jsonb NOT NULL ,
+    attempts integer NOT NULL DEFAULT 0 ,
+    next_attempt_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    last_error text ,
+    sent_at timestamp (0) with time zone );
+
+CREATE INDEX IF NOT EXISTS mail_queue_pending_idx ON "mail_queue" (next_attempt_at) WHERE sent_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS "price_alerts" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    target_price numeric (10, 2) NOT NULL CHECK (target_price > 0),
+    triggered_at timestamp (0) with time zone ,
+    UNIQUE (user_id , foodscale_id ));
+
+CREATE INDEX IF NOT EXISTS price_alerts_foodscale_id_idx ON "price_alerts" (foodscale_id);
+
+CREATE TABLE IF NOT EXISTS "price_alert_notifications" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    target_price numeric (10, 2) NOT NULL ,
+    price integer NOT NULL );
+
+CREATE INDEX IF NOT EXISTS price_alert_notifications_user_id_idx ON "price_alert_notifications" (user_id);
+CREATE INDEX IF NOT EXISTS price_alert_notifications_foodscale_id_idx ON "price_alert_notifications" (foodscale_id);
+
+CREATE TABLE IF NOT EXISTS "price_alert_settings" (
+    user_id bigint PRIMARY KEY REFERENCES "Users" ON DELETE CASCADE ,
+    daily_digest boolean NOT NULL DEFAULT TRUE ,
+    unsubscribed_at timestamp (0) with time zone ,
+    last_digest_at timestamp (0) with time zone );
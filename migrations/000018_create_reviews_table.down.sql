@@ -0,0 +1,9 @@
+DELETE FROM "permissions" WHERE code = 'reviews:moderate' ;
+
+DROP TABLE IF EXISTS "reviews" ;
+
+DROP INDEX IF EXISTS foodscales_rating_count_idx ;
+DROP INDEX IF EXISTS foodscales_rating_avg_idx ;
+
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS rating_count ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS rating_avg ;
@@ -0,0 +1,27 @@
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS rating_avg numeric (3, 2);
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS rating_count integer NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS foodscales_rating_avg_idx ON "FoodScales" (rating_avg);
+CREATE INDEX IF NOT EXISTS foodscales_rating_count_idx ON "FoodScales" (rating_count);
+
+CREATE TABLE IF NOT EXISTS "reviews" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    updated_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    rating smallint NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    body text NOT NULL DEFAULT '' ,
+    status text NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected')),
+    moderated_by bigint REFERENCES "Users" ON DELETE SET NULL ,
+    moderated_at timestamp (0) with time zone ,
+    moderation_note text NOT NULL DEFAULT '' ,
+    version integer NOT NULL DEFAULT 1 ,
+    CONSTRAINT reviews_foodscale_user_key UNIQUE (foodscale_id , user_id ));
+
+CREATE INDEX IF NOT EXISTS reviews_status_idx ON "reviews" (status, created_at);
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx ON "reviews" (user_id);
+
+INSERT INTO "permissions" (code)
+VALUES
+    ('reviews:moderate');
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS "attachments" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    uploaded_by bigint REFERENCES "Users" ON DELETE SET NULL ,
+    kind text NOT NULL CHECK (kind IN ('image', 'document')),
+    filename text NOT NULL ,
+    content_type text NOT NULL ,
+    size bigint NOT NULL ,
+    sha256 bytea NOT NULL ,
+    width integer ,
+    height integer ,
+    blob_key text NOT NULL UNIQUE ,
+    thumbnail_key text UNIQUE );
+
+CREATE INDEX IF NOT EXISTS attachments_foodscale_id_idx ON "attachments" (foodscale_id);
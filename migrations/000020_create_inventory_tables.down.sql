@@ -0,0 +1,5 @@
+DELETE FROM "permissions" WHERE code IN ('inventory:read', 'inventory:write') ;
+DROP TABLE IF EXISTS "stock_levels" ;
+DROP TABLE IF EXISTS "stock_movements" ;
+DROP SEQUENCE IF EXISTS stock_transfers_seq ;
+DROP TABLE IF EXISTS "locations" ;
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS "locations" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    code text NOT NULL ,
+    name text NOT NULL ,
+    address text NOT NULL DEFAULT '' ,
+    version integer NOT NULL DEFAULT 1 );
+
+CREATE UNIQUE INDEX IF NOT EXISTS locations_code_idx ON "locations" (lower(code));
+
+CREATE SEQUENCE IF NOT EXISTS stock_transfers_seq;
+
+CREATE TABLE IF NOT EXISTS "stock_movements" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    location_id bigint NOT NULL REFERENCES "locations" ON DELETE RESTRICT ,
+    kind text NOT NULL CHECK (kind IN ('receipt', 'sale', 'adjustment', 'transfer_out', 'transfer_in')),
+    quantity integer NOT NULL CHECK (quantity <> 0),
+    transfer_id bigint ,
+    reference text NOT NULL DEFAULT '' ,
+    note text NOT NULL DEFAULT '' ,
+    created_by bigint REFERENCES "Users" ON DELETE SET NULL );
+
+CREATE INDEX IF NOT EXISTS stock_movements_foodscale_id_idx ON "stock_movements" (foodscale_id, created_at);
+CREATE INDEX IF NOT EXISTS stock_movements_location_id_idx ON "stock_movements" (location_id);
+CREATE INDEX IF NOT EXISTS stock_movements_transfer_id_idx ON "stock_movements" (transfer_id);
+
+CREATE TABLE IF NOT EXISTS "stock_levels" (
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    location_id bigint NOT NULL REFERENCES "locations" ON DELETE RESTRICT ,
+    on_hand integer NOT NULL DEFAULT 0 CHECK (on_hand >= 0),
+    updated_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (foodscale_id , location_id ));
+
+CREATE INDEX IF NOT EXISTS stock_levels_in_stock_idx ON "stock_levels" (foodscale_id) WHERE on_hand > 0;
+CREATE INDEX IF NOT EXISTS stock_levels_location_id_idx ON "stock_levels" (location_id);
+
+INSERT INTO "permissions" (code)
+VALUES
+    ('inventory:read'),
+    ('inventory:write');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS foodscales_gtin_idx ;
+ALTER TABLE "FoodScales" DROP COLUMN IF EXISTS gtin ;
@@ -0,0 +1,3 @@
+ALTER TABLE "FoodScales" ADD COLUMN IF NOT EXISTS gtin text CHECK (gtin ~ '^[0-9]{14}$') ;
+
+CREATE UNIQUE INDEX IF NOT EXISTS foodscales_gtin_idx ON "FoodScales" (gtin);
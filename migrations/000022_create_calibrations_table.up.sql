@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS "calibrations" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    calibrated_on date NOT NULL ,
+    next_due_on date NOT NULL ,
+    technician text NOT NULL ,
+    tests jsonb NOT NULL ,
+    passed boolean NOT NULL ,
+    notes text NOT NULL DEFAULT '' ,
+    recorded_by bigint REFERENCES "Users" ON DELETE SET NULL ,
+    reminded_at timestamp (0) with time zone ,
+    CONSTRAINT calibrations_due_check CHECK (next_due_on > calibrated_on));
+
+CREATE INDEX IF NOT EXISTS calibrations_foodscale_id_idx ON "calibrations" (foodscale_id, calibrated_on DESC, id DESC);
+CREATE INDEX IF NOT EXISTS calibrations_next_due_on_idx ON "calibrations" (next_due_on) WHERE reminded_at IS NULL;
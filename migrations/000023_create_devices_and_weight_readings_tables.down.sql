@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "weight_readings" ;
+DROP TABLE IF EXISTS "devices" ;
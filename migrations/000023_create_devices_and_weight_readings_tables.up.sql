@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS "devices" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    user_id bigint NOT NULL REFERENCES "Users" ON DELETE CASCADE ,
+    foodscale_id bigint NOT NULL REFERENCES "FoodScales" ON DELETE CASCADE ,
+    name text NOT NULL ,
+    secret_hash bytea NOT NULL ,
+    last_seen_at timestamp (0) with time zone ,
+    version integer NOT NULL DEFAULT 1 );
+
+CREATE INDEX IF NOT EXISTS devices_user_id_idx ON "devices" (user_id);
+CREATE INDEX IF NOT EXISTS devices_foodscale_id_idx ON "devices" (foodscale_id);
+
+CREATE TABLE IF NOT EXISTS "weight_readings" (
+    device_id bigint NOT NULL REFERENCES "devices" ON DELETE CASCADE ,
+    recorded_at timestamp (3) with time zone NOT NULL ,
+    grams double precision NOT NULL ,
+    tare_grams double precision NOT NULL DEFAULT 0 ,
+    stable boolean NOT NULL ,
+    received_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    PRIMARY KEY (device_id , recorded_at ));
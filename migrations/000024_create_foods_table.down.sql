@@ -0,0 +1,2 @@
+DELETE FROM "permissions" WHERE code IN ('foods:read', 'foods:write') ;
+DROP TABLE IF EXISTS "foods" ;
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS "foods" (
+    id bigserial PRIMARY KEY ,
+    created_at timestamp (0) with time zone NOT NULL DEFAULT NOW (),
+    code text ,
+    name text NOT NULL ,
+    brand text NOT NULL DEFAULT '' ,
+    nutrients jsonb NOT NULL DEFAULT '{}' ,
+    version integer NOT NULL DEFAULT 1 );
+
+CREATE UNIQUE INDEX IF NOT EXISTS foods_code_idx ON "foods" (code);
+CREATE INDEX IF NOT EXISTS foods_name_idx ON "foods" USING GIN (to_tsvector('simple', name));
+CREATE INDEX IF NOT EXISTS foods_name_trgm_idx ON "foods" USING GIN (name gin_trgm_ops);
+
+INSERT INTO "permissions" (code)
+VALUES
+    ('foods:read'),
+    ('foods:write');
+
+INSERT INTO "users_permissions" (user_id, permission_id)
+SELECT up.user_id, foods.id
+FROM "users_permissions" up
+JOIN "permissions" scales ON scales.id = up.permission_id
+JOIN "permissions" foods ON foods.code = replace(scales.code, 'scales:', 'foods:')
+WHERE scales.code IN ('scales:read', 'scales:write')
+ON CONFLICT DO NOTHING ;
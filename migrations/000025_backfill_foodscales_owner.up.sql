@@ -0,0 +1,16 @@
+UPDATE "FoodScales"
+SET owner_user_id = COALESCE(created_by, (
+    SELECT min(up.user_id)
+    FROM "users_permissions" up
+    JOIN "permissions" p ON p.id = up.permission_id
+    WHERE p.code = 'scales:admin'))
+WHERE owner_user_id IS NULL AND owner_group_id IS NULL ;
+
+INSERT INTO "groups" (name)
+SELECT 'unowned scales'
+WHERE EXISTS (SELECT 1 FROM "FoodScales" WHERE owner_user_id IS NULL AND owner_group_id IS NULL)
+ON CONFLICT (name) DO NOTHING ;
+
+UPDATE "FoodScales"
+SET owner_group_id = (SELECT id FROM "groups" WHERE name = 'unowned scales')
+WHERE owner_user_id IS NULL AND owner_group_id IS NULL ;
@@ -0,0 +1 @@
+DELETE FROM "permissions" WHERE code IN ('scales:read', 'scales:write') ;
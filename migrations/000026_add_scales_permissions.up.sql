@@ -0,0 +1,3 @@
+INSERT INTO "permissions" (code)
+SELECT code FROM (VALUES ('scales:read'), ('scales:write')) AS p (code)
+WHERE NOT EXISTS (SELECT 1 FROM "permissions" WHERE "permissions".code = p.code) ;
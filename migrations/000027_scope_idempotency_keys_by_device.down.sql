@@ -0,0 +1,4 @@
+DELETE FROM "idempotency_keys" WHERE device_id <> 0 ;
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT IF EXISTS idempotency_keys_pkey ;
+ALTER TABLE "idempotency_keys" DROP COLUMN IF EXISTS device_id ;
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY (user_id , key) ;
@@ -0,0 +1,4 @@
+DELETE FROM "idempotency_keys" WHERE user_id = 0 ;
+ALTER TABLE "idempotency_keys" ADD COLUMN IF NOT EXISTS device_id bigint NOT NULL DEFAULT 0 ;
+ALTER TABLE "idempotency_keys" DROP CONSTRAINT IF EXISTS idempotency_keys_pkey ;
+ALTER TABLE "idempotency_keys" ADD PRIMARY KEY (user_id , device_id , key) ;
@@ -0,0 +1,12 @@
+CREATE OR REPLACE FUNCTION foodscales_record_version () RETURNS trigger AS $$
+BEGIN
+    INSERT INTO "foodscales_versions" (foodscale_id, version, model, year, price, runtime, dimensions)
+    VALUES (NEW.id, NEW.version, NEW.model, NEW.year, NEW.price, NEW.runtime, NEW.dimensions)
+    ON CONFLICT (foodscale_id, version) DO NOTHING;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE "foodscales_versions" DROP COLUMN IF EXISTS manufacturer_id ;
+ALTER TABLE "foodscales_versions" DROP COLUMN IF EXISTS gtin ;
+ALTER TABLE "foodscales_versions" DROP COLUMN IF EXISTS sku ;
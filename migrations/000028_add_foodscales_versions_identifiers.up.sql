@@ -0,0 +1,17 @@
+ALTER TABLE "foodscales_versions" ADD COLUMN IF NOT EXISTS sku text ;
+ALTER TABLE "foodscales_versions" ADD COLUMN IF NOT EXISTS gtin text ;
+ALTER TABLE "foodscales_versions" ADD COLUMN IF NOT EXISTS manufacturer_id bigint ;
+
+UPDATE "foodscales_versions" v
+SET sku = f.sku, gtin = f.gtin, manufacturer_id = f.manufacturer_id
+FROM "FoodScales" f
+WHERE f.id = v.foodscale_id ;
+
+CREATE OR REPLACE FUNCTION foodscales_record_version () RETURNS trigger AS $$
+BEGIN
+    INSERT INTO "foodscales_versions" (foodscale_id, version, model, year, price, runtime, dimensions, sku, gtin, manufacturer_id)
+    VALUES (NEW.id, NEW.version, NEW.model, NEW.year, NEW.price, NEW.runtime, NEW.dimensions, NEW.sku, NEW.gtin, NEW.manufacturer_id)
+    ON CONFLICT (foodscale_id, version) DO NOTHING;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;